@@ -0,0 +1,197 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/addon"
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdAddon represents the addon command
+func NewCmdAddon() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "addon",
+		Short: "Manage the curated add-ons of the clusters",
+		Long: `Install the curated add-ons, such as ingress-nginx, metrics-server and cert-manager, with the
+settings KinD requires for them. They could also be enabled at creation by "kink run --addon"
+		usage: kink addon enable|disable|list`,
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(newCmdAddonEnable(), newCmdAddonDisable(), newCmdAddonList())
+
+	return cmd
+}
+
+func newCmdAddonEnable() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Enable add-ons in a cluster",
+		Long: `Install the add-ons into the cluster and wait for them to be ready. The add-ons publishing ports,
+such as ingress-nginx, and the registry could only be enabled at creation by "kink run --addon"
+		usage: kink addon enable <cluster> <addon>...`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("please provide the name of the cluster and the add-ons as arguments")
+			}
+
+			addons, err := addon.Get(args[1:])
+			if err != nil {
+				return err
+			}
+
+			installer, err := newInstaller(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			return installer.Enable(ctx, addons)
+		},
+	}
+
+	cmd.Flags().DurationVarP(&timeout, "timeout", "t", 5*time.Minute, "How long to wait for the add-ons to be ready")
+
+	return cmd
+}
+
+func newCmdAddonDisable() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Disable add-ons in a cluster",
+		Long: `Delete the objects of the add-ons from the cluster, the ports published at creation are kept
+		usage: kink addon disable <cluster> <addon>...`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("please provide the name of the cluster and the add-ons as arguments")
+			}
+
+			addons, err := addon.Get(args[1:])
+			if err != nil {
+				return err
+			}
+
+			installer, err := newInstaller(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			return installer.Disable(cmd.Context(), addons)
+		},
+	}
+
+	return cmd
+}
+
+func newCmdAddonList() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the add-ons",
+		Long: `List the add-ons in the catalog, and which of them are enabled if a cluster is given
+		usage: kink addon list [cluster]`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("please provide at most one cluster name")
+			}
+
+			var enabled map[string]string
+			if len(args) == 1 {
+				installer, err := newInstaller(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+
+				enabled, err = installer.Enabled(cmd.Context())
+				if err != nil {
+					return err
+				}
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if enabled == nil {
+				fmt.Fprintln(w, "NAME\tVERSION\tDESCRIPTION")
+			} else {
+				fmt.Fprintln(w, "NAME\tVERSION\tENABLED\tDESCRIPTION")
+			}
+			for _, a := range addon.List() {
+				version := a.Version
+				if version == "" {
+					version = "-"
+				}
+				if enabled == nil {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, version, a.Description)
+					continue
+				}
+				_, ok := enabled[a.Name]
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", a.Name, version, ok, a.Description)
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+// newInstaller returns the add-on installer of the cluster in the current namespace
+func newInstaller(ctx context.Context, name string) (*addon.Installer, error) {
+	namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := client.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return clusterInstaller(cluster)
+}
+
+// clusterInstaller returns the add-on installer of the cluster, which logs to the logger of kink
+func clusterInstaller(cluster *kink.Cluster) (*addon.Installer, error) {
+	installer, err := addon.NewInstaller(cluster)
+	if err != nil {
+		return nil, err
+	}
+	installer.Logf = logger.Infof
+
+	return installer, nil
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdAddon()))
+}
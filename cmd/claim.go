@@ -0,0 +1,109 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/ci"
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdClaim represents the claim command
+func NewCmdClaim() *cobra.Command {
+	var outputPath, output, owner string
+	var ttl time.Duration
+
+	currDir, err := os.Getwd()
+	if err != nil {
+		logger.Errorf("could not get current directory: %v", err)
+		os.Exit(1)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "claim",
+		Short: "Claim a ready cluster of a pool",
+		Long: `Take a ready cluster of the pool created by "kink pool create", it becomes yours just like the
+clusters created by "kink run" and its kubeconfig is written
+		usage: kink claim <pool> --ttl 1h`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the pool as an argument")
+			}
+
+			if output != "" && output != "json" && output != "yaml" {
+				return fmt.Errorf("invalid output format %q, it should be json or yaml", output)
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			runnedByLabel, err := runnedBy(owner)
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			var labels map[string]string
+			if job, ok := ci.Detect(); ok {
+				labels = job.Labels()
+			}
+
+			cluster, err := client.Claim(cmd.Context(), namespace, args[0], kink.ClaimOptions{
+				Owner:  runnedByLabel,
+				TTL:    ttl,
+				Labels: labels,
+			})
+			if err != nil {
+				return err
+			}
+
+			kubeconfigPath := filepath.Join(outputPath, "kubeconfig")
+			if err := mergeKubeconfigs(kubeconfigPath, []*kink.Cluster{cluster}); err != nil {
+				return err
+			}
+			cluster.KubeconfigPath = kubeconfigPath
+
+			logger.Infof("Cluster %s is claimed from pool %s, KUBECONFIG file generated at path '%s'", cluster.Name, args[0], kubeconfigPath)
+			return printResult([]*kink.Cluster{cluster}, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputPath, "output-path", "", currDir, "Output path for kubeconfig")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Print the cluster as json or yaml instead of the kubeconfig path")
+	cmd.Flags().DurationVarP(&ttl, "ttl", "", 0, "Time to live of the cluster from now on, it is recorded on the pod")
+	cmd.Flags().StringVarP(&owner, "owner", "", "", "Owner of the cluster, defaults to <user>_<hostname>")
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdClaim()))
+}
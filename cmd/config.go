@@ -0,0 +1,143 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Trendyol/kink/pkg/config"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdConfig represents the config command
+func NewCmdConfig() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the kink config file",
+		Long: `The config file holds the defaults of the flags and named profiles overriding them, it is
+read from ~/.config/kink/config.yaml unless KINK_CONFIG is set
+		usage: kink config view|set|use-profile`,
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(newCmdConfigView(), newCmdConfigSet(), newCmdConfigUseProfile())
+
+	return cmd
+}
+
+func newCmdConfigView() *cobra.Command {
+	var resolved bool
+
+	cmd := &cobra.Command{
+		Use:          "view",
+		Short:        "Print the config file",
+		Long:         `Print the config file, or the defaults resolved from the selected profile with --resolved`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			var out interface{} = cfg
+			if resolved {
+				p, err := cfg.Resolve(profile)
+				if err != nil {
+					return err
+				}
+				out = p
+			}
+
+			data, err := yaml.Marshal(out)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&resolved, "resolved", "", false, "Print the defaults resolved from the selected profile")
+
+	return cmd
+}
+
+func newCmdConfigSet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set a key of the config file",
+		Long: fmt.Sprintf(`Set a key of the defaults, or of the profile given by --profile
+		usage: kink config set <key> <value> [--profile <name>]
+
+Keys: %v`, config.Keys),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("please provide a key and a value as arguments")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Set(profile, args[0], args[1]); err != nil {
+				return err
+			}
+
+			return cfg.Save()
+		},
+	}
+
+	return cmd
+}
+
+func newCmdConfigUseProfile() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use-profile",
+		Short: "Select the profile used by default",
+		Long: `Select the profile used when neither --profile nor KINK_PROFILE is given
+		usage: kink config use-profile <name>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide a profile name as an argument")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			if _, ok := cfg.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %q is not found, available profiles: %v", args[0], cfg.ProfileNames())
+			}
+
+			cfg.CurrentProfile = args[0]
+			return cfg.Save()
+		},
+	}
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewCmdConfig())
+}
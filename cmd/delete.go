@@ -18,77 +18,126 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/user"
 
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/Trendyol/kink/pkg/ci"
+	"github.com/Trendyol/kink/pkg/kink"
 	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 // NewCmdDelete represents the delete command
 func NewCmdDelete() *cobra.Command {
-	var all, force bool
-	var namespace string
+	var all, force, allNamespaces bool
+	var ciPipeline string
 
 	cmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Ephemeral cluster could be deleted by delete command",
-		Long: `You can delete kink cluster by using delete command
-		usage:	kink delete`,
+		Long: `You can delete kink cluster by using delete command, the clusters given by name are deleted
+without asking, including the stopped ones
+		usage:	kink delete [name...]`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			client, err := kubernetes.Client()
+			if allNamespaces && ciPipeline == "" {
+				return errors.New("--all-namespaces could only be used with --ci-pipeline")
+			}
+
+			kinkClient, err := newClient()
 			if err != nil {
 				return err
 			}
+			client := kinkClient.Clientset()
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			podClient := client.CoreV1().Pods(namespace)
+
+			ctx := cmd.Context()
+
+			if len(args) > 0 {
+				for _, name := range args {
+					logger.Infof("Deleting Pod %s and Service %s", name, name)
+					if err := kinkClient.Delete(ctx, namespace, name, force); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			// the jobs of a pipeline may run on different hosts, so the clusters are not filtered by owner.
+			// The IDs of the pipelines of different CI systems could be the same, so the other namespaces
+			// are only searched if asked for, such as for the clusters created by "kink run -f"
+			if ciPipeline != "" {
+				listOptions := metav1.ListOptions{
+					LabelSelector: fmt.Sprintf("%s=%s", types.CIPipelineLabel, ci.LabelValue(ciPipeline)),
+				}
 
-			if namespace == "" {
-				n, _, err := kubernetes.DefaultClientConfig().Namespace()
+				searched := namespace
+				if allNamespaces {
+					searched = metav1.NamespaceAll
+				}
+				pods, err := client.CoreV1().Pods(searched).List(ctx, listOptions)
 				if err != nil {
 					return err
 				}
 
-				namespace = n
-			}
+				// the stopped clusters do not have a pod, only their Service is left
+				services, err := client.CoreV1().Services(searched).List(ctx, listOptions)
+				if err != nil {
+					return err
+				}
 
-			podClient := client.CoreV1().Pods(namespace)
-			serviceClient := client.CoreV1().Services(namespace)
+				for _, p := range pods.Items {
+					err := deletePodAndRelatedService(ctx, kinkClient, p, force, true)
+					if err != nil {
+						return err
+					}
+				}
 
-			ctx := context.TODO()
+				for _, svc := range services.Items {
+					if _, ok := svc.Annotations[types.StoppedPodAnnotation]; !ok {
+						continue
+					}
 
-			currentUser, err := user.Current()
+					logger.Infof("Deleting stopped cluster %s", svc.Name)
+					if err := kinkClient.Delete(ctx, svc.Namespace, svc.Name, force); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			owner, err := profileOwner()
 			if err != nil {
 				return err
 			}
 
-			hostname, err := os.Hostname()
+			runnedByLabel, err := runnedBy(owner)
 			if err != nil {
 				return err
 			}
 
 			pods, err := podClient.List(ctx, metav1.ListOptions{
-				LabelSelector: fmt.Sprintf("runned-by=%s", fmt.Sprintf("%s_%s", currentUser.Username, hostname)),
+				LabelSelector: kink.OwnerSelector(runnedByLabel),
 			})
 
-			options := metav1.DeleteOptions{}
-			if force {
-				gracePeriodSeconds := int64(0)
-				options.GracePeriodSeconds = &gracePeriodSeconds
-			}
-
 			if all {
 				if err != nil {
 					return err
 				}
 
 				for _, p := range pods.Items {
-					err := deletePodAndRelatedService(ctx, p, podClient, options, serviceClient, force)
+					err := deletePodAndRelatedService(ctx, kinkClient, p, force, force)
 					if err != nil {
 						return err
 					}
@@ -116,7 +165,7 @@ func NewCmdDelete() *cobra.Command {
 					return fmt.Errorf("could not get pod: %v", err)
 				}
 
-				err = deletePodAndRelatedService(ctx, *p, podClient, options, serviceClient, force)
+				err = deletePodAndRelatedService(ctx, kinkClient, *p, force, force)
 				if err != nil {
 					return err
 				}
@@ -127,72 +176,63 @@ func NewCmdDelete() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&all, "all", "a", false, "All pods")
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Target namespace")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "force delete")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Delete the clusters of --ci-pipeline in all namespaces")
+	cmd.Flags().StringVarP(&ciPipeline, "ci-pipeline", "", "", "Delete the clusters created by the CI pipeline without asking, such as $CI_PIPELINE_ID")
 
 	return cmd
 }
 
-func deletePodAndRelatedService(ctx context.Context, pod corev1.Pod, podClient v1.PodInterface, options metav1.DeleteOptions, serviceClient v1.ServiceInterface, force bool) error {
+// deletePodAndRelatedService deletes the cluster after the user confirms it unless noPrompt is true,
+// the grace period is skipped if force is true
+func deletePodAndRelatedService(ctx context.Context, client *kink.Client, pod corev1.Pod, force, noPrompt bool) error {
 	var deleteConfirm bool
 	prompt := &survey.Confirm{
 		Message: fmt.Sprintf("Pod %s and Service %s will be deleted... Do you accept?", pod.Name, pod.Name),
 	}
-	shouldDelete := isContainersReady(pod)
 
-	if force {
-		fmt.Printf("Deleting Pod %s\n", pod.Name)
-		if err := podClient.Delete(ctx, pod.Name, options); err != nil {
-			return fmt.Errorf("deleting pod: %q", err)
+	if !noPrompt {
+		err := survey.AskOne(prompt, &deleteConfirm)
+		if err != nil {
+			return err
 		}
 
-		if shouldDelete {
-			fmt.Printf("Deleting Service %s\n", pod.Name)
-			if err := serviceClient.Delete(ctx, pod.Name, options); err != nil {
-				return fmt.Errorf("deleting service: %q", err)
-			}
+		if !deleteConfirm {
+			logger.Infof("Delete operation is discarded")
+			return nil
 		}
-		return nil
-	}
-
-	err := survey.AskOne(prompt, &deleteConfirm)
-	if err != nil {
-		return err
-	}
 
-	if deleteConfirm {
-		var forceDelete bool
-		if !shouldDelete {
+		if !isContainersReady(pod) {
 			p2 := &survey.Confirm{
 				Message: "Pod is not ready yet. Do you want to force delete?",
 			}
+			var forceDelete bool
 			err := survey.AskOne(p2, &forceDelete)
 			if err != nil {
 				return err
 			}
-		}
-		if shouldDelete || forceDelete {
-			fmt.Printf("Deleting Pod %s\n", pod.Name)
-			if err := podClient.Delete(ctx, pod.Name, options); err != nil {
-				return fmt.Errorf("deleting pod: %q", err)
-			}
-
-			if shouldDelete {
-				fmt.Printf("Deleting Service %s\n", pod.Name)
-				if err := serviceClient.Delete(ctx, pod.Name, options); err != nil {
-					return fmt.Errorf("deleting service: %q", err)
-				}
+			if !forceDelete {
+				return nil
 			}
 		}
-	} else {
-		fmt.Println("Delete operation is discarded")
 	}
 
-	return nil
+	logger.Infof("Deleting Pod %s and Service %s", pod.Name, pod.Name)
+	return client.Delete(ctx, pod.Namespace, pod.Name, force)
+}
+
+// isContainersReady returns true if the container of the cluster is ready
+func isContainersReady(pod corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Ready {
+			return true
+		}
+	}
+	return false
 }
 
 func init() {
-	rootCmd.AddCommand(NewCmdDelete())
+	rootCmd.AddCommand(withProfile(NewCmdDelete()))
 
 	// Here you will define your flags and configuration settings.
 
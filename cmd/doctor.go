@@ -0,0 +1,113 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewCmdDoctor represents the doctor command
+func NewCmdDoctor() *cobra.Command {
+	var image, imagePullPolicy, output string
+	var imagePullSecrets []string
+	var timeout int
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check in advance whether clusters could be created",
+		Long: `Check the RBAC permissions, the privileged pods, the image pull, /lib/modules and the cgroup version
+of the nodes, and the reachability of a NodePort from this host. A probe pod and a Service are created
+in the namespace and deleted afterwards
+		usage: kink doctor -n <namespace>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "" && output != "json" {
+				return fmt.Errorf("invalid output format %q, it should be json", output)
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			results, err := client.Doctor(cmd.Context(), namespace, kink.DoctorOptions{
+				Image:            image,
+				ImagePullSecrets: imagePullSecrets,
+				ImagePullPolicy:  corev1.PullPolicy(imagePullPolicy),
+				Timeout:          time.Duration(timeout) * time.Second,
+			})
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+				for _, r := range results {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+
+			failed := 0
+			for _, r := range results {
+				if r.Status == kink.CheckFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed in namespace %s", failed, len(results), namespace)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&image, "image", "", types.ImageRepository+":"+types.ImageTag, "Image of the kind-cluster container to pull")
+	cmd.Flags().StringArrayVarP(&imagePullSecrets, "image-pull-secret", "", []string{}, "Name of the secret to pull the kind-cluster image")
+	cmd.Flags().StringVarP(&imagePullPolicy, "image-pull-policy", "", string(corev1.PullIfNotPresent), "Pull policy of the kind-cluster image")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 120, "Timeout for the probe pod to run, in seconds")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, json")
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdDoctor()))
+}
@@ -17,10 +17,8 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"os/user"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/cli-runtime/pkg/printers"
@@ -32,8 +30,6 @@ import (
 
 // NewCmdList represents the list command
 func NewCmdList() *cobra.Command {
-	var namespace string
-
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all ephemeral cluster",
@@ -46,29 +42,25 @@ func NewCmdList() *cobra.Command {
 				return err
 			}
 
-			if namespace == "" {
-				n, _, err := kubernetes.DefaultClientConfig().Namespace()
-				if err != nil {
-					return err
-				}
-
-				namespace = n
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
 			}
 
 			kubeclient := client.CoreV1().Pods(namespace)
 
-			user, err := user.Current()
+			owner, err := profileOwner()
 			if err != nil {
 				return err
 			}
 
-			hostname, err := os.Hostname()
+			runnedByLabel, err := runnedBy(owner)
 			if err != nil {
 				return err
 			}
 
-			pods, err := kubeclient.List(context.TODO(), metav1.ListOptions{
-				LabelSelector: fmt.Sprintf("runned-by=%s", fmt.Sprintf("%s_%s", user.Username, hostname)),
+			pods, err := kubeclient.List(cmd.Context(), metav1.ListOptions{
+				LabelSelector: fmt.Sprintf("runned-by=%s", runnedByLabel),
 			})
 			if err != nil {
 				return err
@@ -90,13 +82,12 @@ func NewCmdList() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Target namespace")
 
 	return cmd
 }
 
 func init() {
-	rootCmd.AddCommand(NewCmdList())
+	rootCmd.AddCommand(withProfile(NewCmdList()))
 
 	// Here you will define your flags and configuration settings.
 
@@ -16,40 +16,130 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/Trendyol/kink/pkg/compat"
 	"github.com/Trendyol/kink/pkg/types"
-	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/Trendyol/kink/pkg/versions"
 	"github.com/spf13/cobra"
 )
 
 // NewListSupportedVersionsCmd represents the listSupportedVersions command
 func NewListSupportedVersionsCmd() *cobra.Command {
+	var nodeImageRepository, image, compatMatrix, min, max, output string
+	var latest, compatibleOnly bool
+
 	cmd := &cobra.Command{
 		Use:   "list-supported-versions",
 		Short: "List all supported k8s versions",
-		Long:  `You can checkout all supported k8s versions with list-supported-versions flag`,
-		RunE: func(_ *cobra.Command, args []string) error {
+		Long: `You can checkout all supported k8s versions with list-supported-versions flag, versions are
+sorted and the default one is marked. The last fetched list is used when the registry is unreachable.
+		usage: kink list-supported-versions --min 1.20 --max 1.21 --latest -o json`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 {
 				return errors.New("you should not provide any arguments")
 			}
-			tags, err := crane.ListTags(types.NodeImageRepository)
+
+			if output != "" && output != "json" {
+				return fmt.Errorf("invalid output format %q, it should be json", output)
+			}
+
+			tags, fromCache, err := versions.Tags(cmd.Context(), nodeImageRepository)
 			if err != nil {
-				return fmt.Errorf("reading tags for %s: %v", types.NodeImageRepository, err)
+				return err
+			}
+			if fromCache {
+				logger.Warnf("%s could not be reached, using the cached versions", nodeImageRepository)
 			}
 
-			for _, tag := range tags {
-				fmt.Println(tag)
+			matrix, err := compat.Load(compatMatrix)
+			if err != nil {
+				return err
+			}
+
+			imageEntry, known := matrix.ImageByReference(image)
+			if !known {
+				logger.Warnf("image %s is not in the compatibility matrix", image)
+			}
+			if compatibleOnly && known {
+				tags = compat.Compatible(tags, imageEntry.NodeVersions)
+			}
+
+			vs, err := versions.Filter(versions.Sort(tags), min, max)
+			if err != nil {
+				return err
+			}
+
+			// the pre-releases are skipped the same way as by "kink run -k latest"
+			if latest {
+				vs = versions.Releases(vs)
+				if len(vs) > 0 {
+					vs = vs[len(vs)-1:]
+				}
+			}
+
+			supported := make([]supportedVersion, 0, len(vs))
+			for _, v := range vs {
+				supported = append(supported, supportedVersion{
+					Version:    "v" + v.String(),
+					Default:    v.String() == types.NodeImageTag,
+					Compatible: !known || imageEntry.NodeVersions.Contains(v.String()),
+				})
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(supported, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			for _, v := range supported {
+				var notes []string
+				if v.Default {
+					notes = append(notes, "default")
+				}
+				if !v.Compatible {
+					notes = append(notes, fmt.Sprintf("not supported by %s", image))
+				}
+
+				if len(notes) > 0 {
+					fmt.Printf("%s (%s)\n", v.Version, strings.Join(notes, ", "))
+					continue
+				}
+				fmt.Println(v.Version)
 			}
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVarP(&nodeImageRepository, "node-image-repository", "", types.NodeImageRepository, "Repository of the KinD node images")
+	cmd.Flags().StringVarP(&image, "image", "", types.ImageRepository+":"+types.ImageTag, "Image of the kind-cluster container to check the versions against")
+	cmd.Flags().StringVarP(&compatMatrix, "compat-matrix", "", "", "Path to a file overriding the embedded compatibility matrix of kind-cluster images and node versions")
+	cmd.Flags().BoolVarP(&compatibleOnly, "compatible", "", false, "List only the versions supported by the kind-cluster image")
+	cmd.Flags().StringVarP(&min, "min", "", "", "Minimum version to list, such as 1.20 or 1.20.7")
+	cmd.Flags().StringVarP(&max, "max", "", "", "Maximum version to list, such as 1.21 or 1.21.2")
+	cmd.Flags().BoolVarP(&latest, "latest", "", false, "List only the latest version")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, json")
+
 	return cmd
 }
 
+// supportedVersion is a Kubernetes version which has a KinD node image
+type supportedVersion struct {
+	Version    string `json:"version"`
+	Default    bool   `json:"default"`
+	Compatible bool   `json:"compatible"`
+}
+
 func init() {
-	rootCmd.AddCommand(NewListSupportedVersionsCmd())
+	rootCmd.AddCommand(withProfile(NewListSupportedVersionsCmd()))
 
 	// Here you will define your flags and configuration settings.
 
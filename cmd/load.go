@@ -17,168 +17,123 @@ limitations under the License.
 package cmd
 
 import (
-	"bufio"
-	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"strings"
+	"text/tabwriter"
 
+	"github.com/Trendyol/kink/pkg/kink"
 	"github.com/Trendyol/kink/pkg/kubernetes"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // NewCmdLoad represents the load command
 func NewCmdLoad() *cobra.Command {
-	var namespace, clusterName string
+	var clusterName, archivePath, ociLayoutPath, arch string
 	var dockerImages []string
+	var force bool
 
 	cmd := &cobra.Command{
-		Use:          "load",
-		Short:        "Load Docker images into KinD cluster",
-		Long:         `It enables to load Docker images into KinD cluster`,
+		Use:   "load",
+		Short: "Load Docker images into KinD cluster",
+		Long: `It enables to load Docker images into KinD cluster. Images could be taken from the local
+Docker daemon, from a tarball produced by "docker save" or from an OCI image layout directory
+		usage: kink load <name> --docker-image nginx:latest
+		       kink load <name> --archive images.tar
+		       kink load <name> --oci-layout ./layout`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("please provide a name as an argument")
 			}
 
-			if namespace == "" {
-				n, _, err := kubernetes.DefaultClientConfig().Namespace()
-				if err != nil {
-					return err
+			given := 0
+			for _, set := range []bool{len(dockerImages) > 0, archivePath != "", ociLayoutPath != ""} {
+				if set {
+					given++
 				}
-
-				namespace = n
-			}
-
-			nameArg := args[0]
-
-			client, err := kubernetes.Client()
-			if err != nil {
-				return err
-			}
-
-			podClient := client.CoreV1().Pods(namespace)
-			ctx := context.TODO()
-			_, err = podClient.Get(ctx, nameArg, metav1.GetOptions{})
-			if err != nil {
-				return fmt.Errorf("could not get pod: %v", err)
-			}
-
-			// Setup the tar path where the images will be saved
-			dir, err := TempDir("", "images-tar")
-			if err != nil {
-				return errors.New("failed to create tempdir")
 			}
-			defer os.RemoveAll(dir)
-			imagesTarPath := filepath.Join(dir, "images.tar")
-
-			for _, d := range dockerImages {
-				if err := isImageExistLocally(d); err != nil {
-					log.Printf("%s is not found locally, pulling...\n", d)
-					command := exec.Command("docker", []string{"image", "pull", d}...) // #nosec G204
-					stderr, _ := command.StdoutPipe()
-					if err := command.Start(); err != nil {
-						return err
-					}
-
-					scanner := bufio.NewScanner(stderr)
-					for scanner.Scan() {
-						fmt.Println(scanner.Text())
-					}
-
-					if err := command.Wait(); err != nil {
-						return err
-					}
-					log.Printf("%s pulled successfully\n", d)
-				}
+			if given != 1 {
+				return errors.New("please provide exactly one of --docker-image, --archive or --oci-layout")
 			}
 
-			err = save(dockerImages, imagesTarPath)
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
 			if err != nil {
 				return err
 			}
 
-			containerPath := "/tmp/images.tar"
-			err = exec.Command("kubectl", "cp", imagesTarPath, fmt.Sprintf("%s/%s:%s", namespace, nameArg, containerPath)).Run()
-
+			client, err := newClient()
 			if err != nil {
 				return err
 			}
 
-			result, err := doExec(nameArg, namespace, []string{"docker", "load", "-i", containerPath})
+			loaded, err := client.LoadImages(cmd.Context(), namespace, args[0], kink.LoadOptions{
+				ClusterName:  clusterName,
+				DockerImages: dockerImages,
+				Archive:      archivePath,
+				OCILayout:    ociLayoutPath,
+				Arch:         arch,
+				Force:        force,
+				Progress:     loadProgress,
+			})
 			if err != nil {
 				return err
 			}
 
-			log.Println(result)
-
-			for _, n := range dockerImages {
-				ref, err := name.ParseReference(n)
-				if err != nil {
-					return err
-				}
-				args := []string{"kind", "load", "docker-image", ref.Name(), "--name", clusterName, "-v", "8"}
-				result, err := doExec(nameArg, namespace, args)
-				if err != nil {
-					return err
-				}
-
-				log.Println(result)
-			}
-			return nil
+			return printLoadSummary(loaded)
 		},
 	}
-
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Target namespace")
-	cmd.Flags().StringVarP(&clusterName, "cluster-name", "", "", "The name for cluster")
+	cmd.Flags().StringVarP(&clusterName, "cluster-name", "", "", "The name for cluster, defaults to the one recorded on the pod")
 	cmd.Flags().StringArrayVarP(&dockerImages, "docker-image", "", []string{}, "The name for Docker image to be load")
+	cmd.Flags().StringVarP(&archivePath, "archive", "", "", "Path to an image tarball produced by \"docker save\" or a compatible tool")
+	cmd.Flags().StringVarP(&ociLayoutPath, "oci-layout", "", "", "Path to an OCI image layout directory")
+	cmd.Flags().StringVarP(&arch, "arch", "", "amd64", "Architecture to pick from multi-platform images in an OCI layout")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Transfer and load images even if they are already present")
 
 	return cmd
 }
 
-// isImageExistLocally returns error if image is not found locally
-func isImageExistLocally(imageName string) error {
-	if err := exec.Command("docker", "image", "inspect",
-		"-f", "{{ .Id }}",
-		imageName, // ... against the container
-	).Run(); err != nil {
-		return err
-	}
+// loadProgress reports the transfer of the image with a progress bar
+func loadProgress(ref string, size int64) io.WriteCloser {
+	bar := newProgressBar(size, fmt.Sprintf("[cyan]Loading[reset] %s...", ref),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprintln(os.Stderr)
+		}))
 
-	return nil
+	return &progressBarCloser{ProgressBar: bar}
 }
 
-// save saves images to dest, as in `docker save`
-func save(images []string, dest string) error {
-	commandArgs := append([]string{"save", "-o", dest}, images...)
-	return exec.Command("docker", commandArgs...).Run()
+// progressBarCloser completes the bar when it is closed, the size reported by Docker is only an
+// estimate of the tarball size
+type progressBarCloser struct {
+	*progressbar.ProgressBar
 }
 
-// TempDir is like ioutil.TempDir, but more docker friendly
-func TempDir(dir, prefix string) (name string, err error) {
-	// create a tempdir as normal
-	name, err = ioutil.TempDir(dir, prefix)
-	if err != nil {
-		return "", err
-	}
-	// on macOS $TMPDIR is typically /var/..., which is not mountable
-	// /private/var/... is the mountable equivalent
-	if runtime.GOOS == "darwin" && strings.HasPrefix(name, "/var/") {
-		name = filepath.Join("/private", name)
+func (p *progressBarCloser) Close() error {
+	return p.Finish()
+}
+
+// printLoadSummary prints the IDs of the loaded and skipped images on each node
+func printLoadSummary(loaded []kink.LoadedImage) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tIMAGE\tID\tSTATUS")
+	for _, l := range loaded {
+		id := l.ID
+		if id == "" {
+			id = "<missing>"
+		}
+		status := "loaded"
+		if l.Skipped {
+			status = "skipped"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Node, l.Ref, id, status)
 	}
-	return name, nil
+
+	return w.Flush()
 }
 
 func init() {
-	rootCmd.AddCommand(NewCmdLoad())
+	rootCmd.AddCommand(withProfile(NewCmdLoad()))
 }
@@ -0,0 +1,274 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewCmdPool represents the pool command
+func NewCmdPool() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pool",
+		Short: "Manage pools of ready clusters",
+		Long: `A pool keeps a number of ready clusters which could be claimed by "kink claim" right away,
+"kink pool reconcile" tops the pool up after its clusters are claimed
+		usage: kink pool create|status|reconcile|delete`,
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(newCmdPoolCreate(), newCmdPoolStatus(), newCmdPoolReconcile(), newCmdPoolDelete())
+
+	return cmd
+}
+
+func newCmdPoolCreate() *cobra.Command {
+	var k8sVersion, image, nodeImageRepository, nodeImage, imagePullPolicy, expose string
+	var cpu, memory, cpuLimit, memoryLimit string
+	var imagePullSecrets, registryMirrors, insecureRegistries []string
+	var size, timeout int
+	var withRegistry, noWait bool
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a pool or update its spec",
+		Long: `Create a pool of ready clusters or update its spec, and wait until the pool is filled
+		usage: kink pool create <name> --size 5 -k 1.21.2`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the pool as an argument")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			resources, err := resourceRequirements(cpu, memory, cpuLimit, memoryLimit)
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			err = client.ApplyPool(cmd.Context(), kink.PoolSpec{
+				Name:                args[0],
+				Namespace:           namespace,
+				Size:                size,
+				KubernetesVersion:   k8sVersion,
+				Image:               image,
+				NodeImageRepository: nodeImageRepository,
+				NodeImage:           nodeImage,
+				ImagePullSecrets:    imagePullSecrets,
+				ImagePullPolicy:     corev1.PullPolicy(imagePullPolicy),
+				Resources:           resources,
+				Expose:              kink.ExposeMode(expose),
+				WithRegistry:        withRegistry,
+				RegistryMirrors:     registryMirrors,
+				InsecureRegistries:  insecureRegistries,
+				Timeout:             metav1.Duration{Duration: time.Duration(timeout) * time.Second},
+			})
+			if err != nil {
+				return err
+			}
+			logger.Infof("Pool %s is saved", args[0])
+
+			if noWait {
+				return nil
+			}
+			return reconcilePool(cmd, client, namespace, args[0])
+		},
+	}
+
+	cmd.Flags().IntVarP(&size, "size", "", 1, "Number of ready, unclaimed clusters to keep")
+	cmd.Flags().BoolVarP(&noWait, "no-wait", "", false, "Only save the pool, its clusters are created by \"kink pool reconcile\"")
+	cmd.Flags().StringVarP(&k8sVersion, "kubernetes-version", "k", types.NodeImageTag, "Desired version of Kubernetes, such as 1.21.2, 1.21, latest or stable-N")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 240, "timeout for wait")
+	cmd.Flags().StringVarP(&image, "image", "", types.ImageRepository+":"+types.ImageTag, "Image of the kind-cluster container")
+	cmd.Flags().StringVarP(&nodeImageRepository, "node-image-repository", "", types.NodeImageRepository, "Repository of the KinD node images")
+	cmd.Flags().StringVarP(&nodeImage, "node-image", "", "", "Full reference of the KinD node image, overrides --kubernetes-version")
+	cmd.Flags().StringArrayVarP(&imagePullSecrets, "image-pull-secret", "", []string{}, "Name of the secret to pull the kind-cluster image")
+	cmd.Flags().StringVarP(&imagePullPolicy, "image-pull-policy", "", string(corev1.PullIfNotPresent), "Pull policy of the kind-cluster image")
+	cmd.Flags().StringVarP(&expose, "expose", "", "nodeport", "How the API server is exposed, nodeport or clusterip for clients running in the same cluster")
+	cmd.Flags().StringVarP(&cpu, "cpu", "", "", "CPU request of the kind-cluster container")
+	cmd.Flags().StringVarP(&memory, "memory", "", "", "Memory request of the kind-cluster container")
+	cmd.Flags().StringVarP(&cpuLimit, "cpu-limit", "", "", "CPU limit of the kind-cluster container")
+	cmd.Flags().StringVarP(&memoryLimit, "memory-limit", "", "", "Memory limit of the kind-cluster container")
+	cmd.Flags().BoolVarP(&withRegistry, "with-registry", "", false, "Run a local registry which is wired into the KinD cluster")
+	cmd.Flags().StringArrayVarP(&registryMirrors, "registry-mirror", "", []string{}, "Registry mirror in the form of host=url for the Docker daemon and the KinD nodes, a bare url mirrors Docker Hub")
+	cmd.Flags().StringArrayVarP(&insecureRegistries, "insecure-registry", "", []string{}, "Registry host whose TLS certificate should not be verified")
+
+	return cmd
+}
+
+func newCmdPoolStatus() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the capacity of the pools",
+		Long: `Show the ready, creating and claimed clusters of the pool, or of all the pools in the namespace
+		usage: kink pool status [name] -o json`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("please provide at most one pool name")
+			}
+			if output != "" && output != "json" {
+				return fmt.Errorf("invalid output format %q, it should be json", output)
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			var statuses []*kink.PoolStatus
+			if len(args) == 1 {
+				status, err := client.PoolStatus(cmd.Context(), namespace, args[0])
+				if err != nil {
+					return err
+				}
+				statuses = append(statuses, status)
+			} else {
+				statuses, err = client.ListPools(cmd.Context(), namespace)
+				if err != nil {
+					return err
+				}
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(statuses, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSIZE\tREADY\tCREATING\tCLAIMED")
+			for _, s := range statuses {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", s.Name, s.Size, s.Ready, s.Creating, s.Claimed)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, json")
+
+	return cmd
+}
+
+func newCmdPoolReconcile() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Top the pool up",
+		Long: `Create clusters until the pool has as many ready clusters as its size, and delete the failed ones.
+It could be run periodically, such as by a CronJob or a scheduled pipeline
+		usage: kink pool reconcile <name>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the pool as an argument")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			return reconcilePool(cmd, client, namespace, args[0])
+		},
+	}
+
+	return cmd
+}
+
+func newCmdPoolDelete() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the pool and its unclaimed clusters",
+		Long: `Delete the pool and its unclaimed clusters, the claimed ones are left to their claimants
+		usage: kink pool delete <name>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the pool as an argument")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			return client.DeletePool(cmd.Context(), namespace, args[0])
+		},
+	}
+
+	return cmd
+}
+
+// reconcilePool tops the pool up and logs the result
+func reconcilePool(cmd *cobra.Command, client *kink.Client, namespace, name string) error {
+	created, err := client.ReconcilePool(cmd.Context(), namespace, name)
+	if err != nil {
+		return err
+	}
+
+	if created == 0 {
+		logger.Infof("Pool %s is full", name)
+		return nil
+	}
+	logger.Infof("Pool %s is topped up with %d clusters", name, created)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdPool()))
+}
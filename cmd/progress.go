@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/k0kubun/go-ansi"
+)
+
+// multiProgress draws a status line per cluster which are created concurrently
+type multiProgress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	visible bool
+	names   []string
+	status  []string
+	width   int
+	// drawn is the number of lines drawn, they are redrawn in place
+	drawn int
+}
+
+// newMultiProgress returns a display of the names, it is hidden if the progress should not be shown
+func newMultiProgress(names []string) *multiProgress {
+	m := &multiProgress{
+		out:     ansi.NewAnsiStderr(),
+		visible: showProgress(),
+		names:   names,
+		status:  make([]string, len(names)),
+	}
+	for i, n := range names {
+		m.status[i] = "waiting"
+		if len(n) > m.width {
+			m.width = len(n)
+		}
+	}
+	return m
+}
+
+// set updates the status of the ith name, it is logged if the status lines are hidden
+func (m *multiProgress) set(i int, status string) {
+	if !m.visible {
+		logger.Infof("%s: %s", m.names[i], status)
+	}
+	m.update(i, status)
+}
+
+// update updates the status of the ith name without logging it, such as the elapsed time
+func (m *multiProgress) update(i int, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status[i] = status
+	m.render()
+}
+
+// logf writes the message of the ith name above the status lines
+func (m *multiProgress) logf(i int, format string, args ...interface{}) {
+	if !m.visible {
+		logger.Infof("%s: "+format, append([]interface{}{m.names[i]}, args...)...)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clear()
+	fmt.Fprintf(m.out, "%s: %s\n", m.names[i], strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+	m.render()
+}
+
+func (m *multiProgress) clear() {
+	if m.drawn > 0 {
+		fmt.Fprintf(m.out, "\033[%dA", m.drawn)
+		for i := 0; i < m.drawn; i++ {
+			fmt.Fprint(m.out, "\033[2K\n")
+		}
+		fmt.Fprintf(m.out, "\033[%dA", m.drawn)
+		m.drawn = 0
+	}
+}
+
+func (m *multiProgress) render() {
+	if !m.visible {
+		return
+	}
+
+	if m.drawn > 0 {
+		fmt.Fprintf(m.out, "\033[%dA", m.drawn)
+	}
+	for i, n := range m.names {
+		fmt.Fprintf(m.out, "\033[2K%-*s  %s\n", m.width, n, m.status[i])
+	}
+	m.drawn = len(m.names)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewCmdPush represents the push command
+func NewCmdPush() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Push Docker images into the local registry of KinD cluster",
+		Long: `It enables to push Docker images from the local Docker daemon into the registry of a KinD
+cluster created with --with-registry, images are reachable as localhost:5001/<repository> inside the cluster
+		usage: kink push <name> <image>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("please provide a name and an image as arguments")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			nameArg, image := args[0], args[1]
+
+			client, err := kubernetes.Client()
+			if err != nil {
+				return err
+			}
+
+			pod, err := client.CoreV1().Pods(namespace).Get(cmd.Context(), nameArg, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("could not get pod: %v", err)
+			}
+
+			registryHost, ok := pod.Annotations[types.RegistryAnnotation]
+			if !ok {
+				return fmt.Errorf("pod %s does not have a registry, please create it with --with-registry", nameArg)
+			}
+
+			ref, err := name.ParseReference(image)
+			if err != nil {
+				return err
+			}
+
+			img, err := daemon.Image(ref)
+			if err != nil {
+				return fmt.Errorf("reading image %s from the local Docker daemon: %w", image, err)
+			}
+
+			localPort, stop, err := kubernetes.PortForward(namespace, nameArg, types.RegistryPort)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			path := ref.Context().RepositoryStr() + referenceDelimiter(ref) + ref.Identifier()
+			dst, err := name.ParseReference(fmt.Sprintf("localhost:%d/%s", localPort, path), name.Insecure)
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("pushing %s...", image)
+			if err := remote.Write(dst, img, remote.WithContext(cmd.Context())); err != nil {
+				return fmt.Errorf("pushing image %s: %w", image, err)
+			}
+
+			logger.Infof("Image %s pushed, it could be referenced as %s/%s inside the KinD cluster", image, registryHost, path)
+			fmt.Printf("%s/%s\n", registryHost, path)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// referenceDelimiter returns the delimiter between the repository and the identifier of the reference
+func referenceDelimiter(r name.Reference) string {
+	if _, ok := r.(name.Digest); ok {
+		return "@"
+	}
+	return ":"
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdPush()))
+}
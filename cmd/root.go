@@ -17,9 +17,31 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Trendyol/kink/pkg/config"
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	kinklog "github.com/Trendyol/kink/pkg/logger"
+	"github.com/k0kubun/go-ansi"
+	"github.com/mattn/go-isatty"
+	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// profile is the name of the profile selected from the config file
+var profile string
+
+// Diagnostic messages are written to stderr by the logger, stdout is reserved for the results
+var (
+	logFormat string
+	verbosity int
+	quiet     bool
+	logger, _ = kinklog.New(os.Stderr, kinklog.FormatText, 0, false)
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -30,12 +52,152 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	SilenceErrors: true,
+}
+
+// setupLogger configures the logger from the flags
+func setupLogger() error {
+	l, err := kinklog.New(os.Stderr, kinklog.Format(logFormat), verbosity, quiet)
+	if err != nil {
+		return err
+	}
+
+	logger = l
+	return nil
+}
+
+// showProgress returns true if the progress bars could be drawn. They are not when stdout is parsed by
+// another program, nor when stderr, which they are drawn on, is redirected.
+func showProgress() bool {
+	return !quiet && logFormat == string(kinklog.FormatText) &&
+		isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd())
+}
+
+// newProgressBar returns a progress bar drawn on stderr, it is hidden if the progress should not be shown
+func newProgressBar(max int64, description string, options ...progressbar.Option) *progressbar.ProgressBar {
+	options = append([]progressbar.Option{
+		progressbar.OptionSetWriter(ansi.NewAnsiStderr()),
+		progressbar.OptionSetVisibility(showProgress()),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+	}, options...)
+
+	return progressbar.NewOptions64(max, options...)
+}
+
+// withProfile makes the command and its subcommands take the defaults of their flags from the selected
+// profile. The commands which do not use them, such as version and config, work even if the config
+// file is broken.
+func withProfile(cmd *cobra.Command) *cobra.Command {
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd.Flags())
+	}
+	return cmd
+}
+
+// applyConfig sets the flags which are not given on the command line from the selected profile
+func applyConfig(flags *pflag.FlagSet) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	p, err := cfg.Resolve(profile)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range p.Flags() {
+		f := flags.Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		// the timeout of the profile is in seconds, the durations such as the timeout of the add-ons
+		// are not the same setting
+		if name == "timeout" && f.Value.Type() != "int" {
+			continue
+		}
+
+		for _, v := range values {
+			if err := flags.Set(name, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// profileOwner returns the owner set by the selected profile, it is empty unless the profile sets it
+func profileOwner() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+
+	p, err := cfg.Resolve(profile)
+	if err != nil {
+		return "", err
+	}
+
+	return p.Owner, nil
+}
+
+// newClient returns the kink client for the cluster in the kubeconfig
+func newClient() (*kink.Client, error) {
+	restConfig, err := kubernetes.RestClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kink.NewClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	client.Logf = logger.Infof
+
+	return client, nil
+}
+
+func init() {
+	cobra.OnInitialize(func() {
+		if err := setupLogger(); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+	})
+
+	kubernetes.AddFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Log more details, could be repeated such as -vv")
+	rootCmd.PersistentFlags().StringVarP(&logFormat, "log-format", "", string(kinklog.FormatText), "Format of the logs written to stderr, text or json")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log errors and hide the progress bars")
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "", "", "Profile of the config file to use, could be set by KINK_PROFILE")
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The commands are cancelled on SIGINT or SIGTERM so that they could clean up, a second signal
+// terminates kink right away.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
 }
@@ -17,435 +17,325 @@ limitations under the License.
 package cmd
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
-	"net/url"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapilatest "k8s.io/client-go/tools/clientcmd/api/latest"
 
+	"github.com/Trendyol/kink/pkg/addon"
+	"github.com/Trendyol/kink/pkg/ci"
+	"github.com/Trendyol/kink/pkg/compat"
+	"github.com/Trendyol/kink/pkg/config"
+	"github.com/Trendyol/kink/pkg/kink"
 	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/manifest"
 	"github.com/Trendyol/kink/pkg/types"
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/apimachinery/pkg/util/uuid"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // NewCmdRun represents the run command
 func NewCmdRun() *cobra.Command {
-	var k8sVersion, namespace, outputPath, clusterName string
+	var k8sVersion, outputPath, output, clusterName string
+	var image, nodeImageRepository, nodeImage, imagePullPolicy, compatMatrix string
+	var ttl time.Duration
+	var expose, owner, cpu, memory, cpuLimit, memoryLimit string
+	var imagePullSecrets []string
 	var timeout int
+	var withRegistry, githubOutput, atomic, persistent bool
+	var exportEnv, clustersFile, fromSnapshot, storageSize, storageClass string
+	var count, parallelism int
+	var registryMirrors, insecureRegistries []string
+	var applyPaths, waitFor, addonNames, waitForInner []string
+	var waitTimeout time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Ephemeral cluster could be created by run command",
 		Long: `It enables to create a cluster inside Kubernetes. Example command is shown below
-		kink run <>`,
+		kink run <>
+		kink run <> --count 3 --atomic
+		kink run -f clusters.yaml --parallelism 2
+		kink run <> --apply manifests/ --wait-for deployment/foo
+		kink run <> --addon ingress-nginx,metrics-server`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 1 {
+			if clustersFile == "" && len(args) < 1 {
 				return errors.New("please provide a name as an argument")
 			}
+			if clustersFile != "" && (len(args) > 0 || count > 1) {
+				return errors.New("neither a name nor --count could be given along with --filename")
+			}
+			if count < 1 {
+				return errors.New("--count should be at least 1")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			// -o used to be the shorthand of --output-path, only the values which look like a path are
+			// taken as it, so that a mistyped format is not taken as a directory
+			if output != "" && output != "json" && output != "yaml" {
+				if !looksLikePath(output) {
+					return fmt.Errorf("invalid output format %q, it should be json or yaml", output)
+				}
+				logger.Warnf("-o %s is taken as --output-path, which is deprecated, -o is the output format now", output)
+				outputPath, output = output, ""
+			}
 
-			if namespace == "" {
-				n, _, err := kubernetes.DefaultClientConfig().Namespace()
+			// the manifests are read before creating the clusters, so that a wrong path fails fast
+			var objs []*unstructured.Unstructured
+			for _, p := range applyPaths {
+				o, err := manifest.Read(cmd.Context(), p)
 				if err != nil {
 					return err
 				}
-
-				namespace = n
+				objs = append(objs, o...)
 			}
-
-			name := args[0]
-
-			client, err := kubernetes.Client()
+			if err := manifest.ValidateResources(waitFor); err != nil {
+				return err
+			}
+			addons, err := addon.Get(addonNames)
 			if err != nil {
 				return err
 			}
-
-			podClient := client.CoreV1().Pods(namespace)
-
-			generatedUUID := uuid.NewUUID()
-
-			// podName := "kind-cluster-" + string(generatedUUID)
-
-			currentUser, err := user.Current()
+			innerChecks, err := kink.ParseInnerChecks(waitForInner)
 			if err != nil {
 				return err
 			}
 
-			hostname, err := os.Hostname()
+			matrix, err := compat.Load(compatMatrix)
 			if err != nil {
 				return err
 			}
 
-			if clusterName == "" {
-				clusterName = "kind-" + string(generatedUUID)
-			}
-
-			runnedByLabel := fmt.Sprintf("%s_%s", currentUser.Username, hostname)
-			labels := map[string]string{
-				"runned-by":      runnedByLabel,
-				"generated-uuid": string(generatedUUID),
-			}
-			podObj := &corev1.Pod{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       "Pod",
-					APIVersion: "v1",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        name,
-					Annotations: kubernetes.ManagedAnnotations(),
-					Labels:      labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: "varlibdocker",
-							VolumeSource: corev1.VolumeSource{
-								EmptyDir: &corev1.EmptyDirVolumeSource{},
-							},
-						},
-						{
-							Name: "libmodules",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/lib/modules",
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						{
-							Name:  "kind-cluster",
-							Image: types.ImageRepository + ":" + types.ImageTag,
-							Args: []string{
-								"/bin/bash",
-							},
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "api-server-port",
-									HostPort:      0,
-									ContainerPort: 30001,
-									Protocol:      corev1.Protocol("TCP"),
-								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name: "API_SERVER_ADDRESS",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											FieldPath: "status.podIP",
-										},
-									},
-								},
-								{
-									Name: "CERT_SANS",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											FieldPath: "status.hostIP",
-										},
-									},
-								},
-								{
-									Name:  "KIND_CLUSTER_NAME",
-									Value: clusterName,
-								},
-								{
-									Name:  "KIND_NODE_IMAGE",
-									Value: types.NodeImageRepository + ":v" + k8sVersion,
-								},
-							},
-							Resources: corev1.ResourceRequirements{},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "varlibdocker",
-									MountPath: "/var/lib/docker",
-								},
-								{
-									Name:      "libmodules",
-									ReadOnly:  true,
-									MountPath: "/lib/modules",
-								},
-							},
-							ReadinessProbe: &corev1.Probe{
-								Handler: corev1.Handler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/healthz",
-										Port: intstr.IntOrString{
-											Type:   intstr.Type(1),
-											IntVal: 0,
-											StrVal: "api-server-port",
-										},
-										Scheme: corev1.URIScheme("HTTPS"),
-									},
-								},
-								InitialDelaySeconds: 120,
-								TimeoutSeconds:      1,
-								PeriodSeconds:       20,
-								SuccessThreshold:    1,
-								FailureThreshold:    15,
-							},
-							ImagePullPolicy: corev1.PullPolicy("IfNotPresent"),
-							SecurityContext: &corev1.SecurityContext{
-								Privileged: ptrbool(true),
-							},
-							Stdin: true,
-							TTY:   true,
-						},
-					},
-				},
-			}
-
-			// Manage resource
-			ctx := context.TODO()
-			_, err = podClient.Create(ctx, podObj, metav1.CreateOptions{})
+			resources, err := resourceRequirements(cpu, memory, cpuLimit, memoryLimit)
 			if err != nil {
 				return err
 			}
 
-			bar := progressbar.NewOptions(timeout,
-				progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-				progressbar.OptionEnableColorCodes(true),
-				progressbar.OptionShowBytes(true),
-				progressbar.OptionSetWidth(15),
-				progressbar.OptionSetDescription(fmt.Sprintf("[cyan][1/1][reset] Creating Pod %s...", name)),
-				progressbar.OptionSetTheme(progressbar.Theme{
-					Saucer:        "[green]=[reset]",
-					SaucerHead:    "[green]>[reset]",
-					SaucerPadding: " ",
-					BarStart:      "[",
-					BarEnd:        "]",
-				}))
-
-			err = wait.PollImmediate(time.Second, time.Duration(timeout)*time.Second, func() (done bool, err error) {
-				_ = bar.Add(1)
-
-				pod, err := podClient.Get(ctx, name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-
-				switch pod.Status.Phase {
-				case corev1.PodFailed, corev1.PodSucceeded:
-					return false, wait.ErrWaitTimeout
-				}
-
-				if isContainersReady(*pod) {
-					_ = bar.Finish()
-					return true, nil
-				}
+			runnedByLabel, err := runnedBy(owner)
+			if err != nil {
+				return err
+			}
 
-				return false, nil
-			})
+			var labels map[string]string
+			if job, ok := ci.Detect(); ok {
+				labels = job.Labels()
+				logger.Debugf("running in CI, labeling the cluster with %v", labels)
+			}
 
+			size, err := resource.ParseQuantity(storageSize)
 			if err != nil {
-				log.Printf("the pod never entered running phase: %v\n", err)
-				log.Println("rolling back the operation...")
-				err = podClient.Delete(ctx, name, metav1.DeleteOptions{})
-				if err != nil {
-					log.Fatalf("could not delete the Pod: %q", err)
-				}
-				return nil
+				return fmt.Errorf("invalid storage size %q: %w", storageSize, err)
 			}
 
-			kubeconfig, err := doExec(name, namespace, []string{"kubectl", "config", "view", "--minify", "--flatten"})
-			if err != nil {
-				return err
+			var snapshot *kink.SnapshotSource
+			if fromSnapshot != "" {
+				snapshot = parseSnapshotSource(fromSnapshot)
 			}
 
-			hostIP, err := doExec(name, namespace, []string{"sh", "-c", "echo $CERT_SANS"})
+			specs, err := runSpecs(kink.Spec{
+				Namespace:           namespace,
+				ClusterName:         clusterName,
+				KubernetesVersion:   k8sVersion,
+				Image:               image,
+				NodeImageRepository: nodeImageRepository,
+				NodeImage:           nodeImage,
+				ImagePullSecrets:    imagePullSecrets,
+				ImagePullPolicy:     corev1.PullPolicy(imagePullPolicy),
+				CompatMatrix:        matrix,
+				Resources:           resources,
+				TTL:                 ttl,
+				Expose:              kink.ExposeMode(expose),
+				Owner:               runnedByLabel,
+				Labels:              labels,
+				WithRegistry:        withRegistry,
+				RegistryMirrors:     registryMirrors,
+				InsecureRegistries:  insecureRegistries,
+				Persistent:          persistent,
+				StorageSize:         size,
+				StorageClass:        storageClass,
+				Snapshot:            snapshot,
+				InnerChecks:         innerChecks,
+				Timeout:             time.Duration(timeout) * time.Second,
+			}, args, count, clustersFile)
 			if err != nil {
 				return err
 			}
+			for i := range specs {
+				addon.Configure(&specs[i], addons)
+				if specs[i].Expose == kink.ExposeClusterIP && (len(addons) > 0 || len(objs) > 0 || len(waitFor) > 0) {
+					return fmt.Errorf("--addon, --apply and --wait-for could not be used for the cluster %s, kink could not reach the clusters exposed by clusterip", specs[i].ClusterName)
+				}
+			}
 
-			podIP, err := doExec(name, namespace, []string{"sh", "-c", "echo $API_SERVER_ADDRESS"})
-			if err != nil {
-				return err
+			// the clusters are bootstrapped as a part of their creation, so that --atomic covers it
+			bootstrapCluster := func(ctx context.Context, c *kink.Cluster, logf func(string, ...interface{})) error {
+				if len(addons) == 0 && len(objs) == 0 && len(waitFor) == 0 {
+					return nil
+				}
+				return bootstrap(ctx, c, addons, objs, waitFor, waitTimeout, logf)
 			}
 
-			kubeconfig = strings.ReplaceAll(kubeconfig, podIP, hostIP)
-
-			serviceClient := client.CoreV1().Services(namespace)
-
-			// Create resource object
-			serviceObj := &corev1.Service{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       "Service",
-					APIVersion: "v1",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      name,
-					Namespace: namespace,
-					Labels:    labels,
-				},
-				Spec: corev1.ServiceSpec{
-					Ports: []corev1.ServicePort{
-						{
-							Port: 30001,
-							TargetPort: intstr.IntOrString{
-								Type:   intstr.Type(0),
-								IntVal: 30001,
-							},
-						},
-					},
-					Selector: labels,
-					Type:     corev1.ServiceType("NodePort"),
-				},
-			}
-
-			// Manage resource
-			svc, err := serviceClient.Create(ctx, serviceObj, metav1.CreateOptions{})
-			if err != nil {
-				// if target service already exist, we do not need to create it again
-				if k8serrors.IsAlreadyExists(err) {
-					svcGet, err := serviceClient.Get(ctx, name, metav1.GetOptions{})
-					if err != nil {
-						return fmt.Errorf("could not get service: %w", err)
-					}
+			var clusters []*kink.Cluster
+			var createErr error
+			if len(specs) == 1 {
+				client, err := newClient()
+				if err != nil {
+					return err
+				}
 
-					toUpdate := serviceObj.DeepCopy()
-					toUpdate.ObjectMeta = svcGet.ObjectMeta
-					toUpdate.Spec.ClusterIP = svcGet.Spec.ClusterIP
-					toUpdate.Spec.ClusterIPs = svcGet.Spec.ClusterIPs
+				spec := specs[0]
+				bar := newProgressBar(int64(spec.Timeout.Seconds()), fmt.Sprintf("[cyan][1/1][reset] Creating Pod %s...", spec.Name))
+				spec.Progress = func() {
+					_ = bar.Add(1)
+				}
 
-					svc, err = serviceClient.Update(ctx, toUpdate, metav1.UpdateOptions{})
-					if err != nil {
-						return fmt.Errorf("could not update service: %w", err)
+				cluster, err := client.Create(cmd.Context(), spec)
+				if err != nil {
+					return err
+				}
+				_ = bar.Finish()
+
+				if err := bootstrapCluster(cmd.Context(), cluster, logger.Infof); err != nil {
+					if atomic {
+						return rollbackCluster(client, cluster, err)
 					}
-				} else {
-					return fmt.Errorf("could not create service: %w", err)
+					createErr = err
+				}
+				clusters = append(clusters, cluster)
+			} else {
+				clusters, createErr = createClusters(cmd.Context(), specs, parallelism, atomic, bootstrapCluster)
+				// the kubeconfig of the created clusters is written even if the others failed
+				if len(clusters) == 0 {
+					return createErr
 				}
 			}
 
-			nodePort := svc.Spec.Ports[0].NodePort
-			kubeconfig = strings.ReplaceAll(kubeconfig, "30001", fmt.Sprint(nodePort))
-
 			kubeconfigPath := filepath.Join(outputPath, "kubeconfig")
-
-			dname, err := ioutil.TempDir("", "kink_kubeconfig")
-			if err != nil {
+			if err := mergeKubeconfigs(kubeconfigPath, clusters); err != nil {
 				return err
 			}
-			defer os.RemoveAll(dname)
-			tmpKubeconfigPath := filepath.Join(dname, "kubeconfig")
-			err = WriteFile(tmpKubeconfigPath, []byte(kubeconfig), 0o600)
 
-			if err != nil {
-				return err
-			}
+			if len(clusters) == 1 {
+				name, namespace := clusters[0].Name, clusters[0].Namespace
+				logger.Infof(`Thanks for using kink!
+Pod %s and Service %s created successfully!
 
-			fmt.Printf("KUBECONFIG file has been written to the directory: %s\n", tmpKubeconfigPath)
+You can view the logs by running the following command:
+$ kubectl logs -f %s -n %s 
+
+KUBECONFIG file generated at path '%s'. 
+Start managing your internal KinD cluster by running the following command:
+$ KUBECONFIG=%s kubectl get nodes -o wide`, name, name, name, namespace, kubeconfigPath, kubeconfigPath)
+			} else {
+				var contexts []string
+				for _, c := range clusters {
+					kubeconfig, err := clientcmd.Load(c.Kubeconfig)
+					if err != nil {
+						return err
+					}
+					contexts = append(contexts, kubeconfig.CurrentContext)
+				}
+				logger.Infof(`Thanks for using kink!
+%d clusters created successfully!
 
-			kubeConfigs := []string{kubeconfigPath, tmpKubeconfigPath}
-			rules := clientcmd.ClientConfigLoadingRules{
-				Precedence: kubeConfigs,
+KUBECONFIG file generated at path '%s' with the contexts %s.
+Start managing your internal KinD clusters by running the following command:
+$ KUBECONFIG=%s kubectl --context %s get nodes -o wide`, len(clusters), kubeconfigPath, strings.Join(contexts, ", "), kubeconfigPath, contexts[0])
 			}
 
-			mergedConfig, err := rules.Load()
-			if err != nil {
-				return err
+			for _, c := range clusters {
+				c.KubeconfigPath = kubeconfigPath
 			}
 
-			encode, err := runtime.Encode(clientcmdapilatest.Codec, mergedConfig)
-			if err != nil {
-				return err
+			if exportEnv != "" {
+				if err := writeEnv(exportEnv, clusterEnv(clusters)); err != nil {
+					return err
+				}
 			}
 
-			merged, err := yaml.JSONToYAML(encode)
-			if err != nil {
-				return err
+			if githubOutput {
+				path := os.Getenv("GITHUB_OUTPUT")
+				if path == "" {
+					return errors.New("--github-output is given but GITHUB_OUTPUT is not set")
+				}
+				if err := writeEnv(path, clusterEnv(clusters)); err != nil {
+					return err
+				}
 			}
 
-			err = WriteFile(kubeconfigPath, merged, 0o600)
-			if err != nil {
+			if err := printResult(clusters, output); err != nil {
 				return err
 			}
 
-			fmt.Printf(`Thanks for using kink!
-Pod %s and Service %s created successfully!
-
-You can view the logs by running the following command:
-$ kubectl logs -f %s -n %s 
-
-KUBECONFIG file generated at path '%s'. 
-Start managing your internal KinD cluster by running the following command:
-$ KUBECONFIG=%s kubectl get nodes -o wide`, name, name, name, namespace, kubeconfigPath, kubeconfigPath)
-			return nil
+			return createErr
 		},
 	}
 
 	currDir, err := os.Getwd()
 	if err != nil {
-		log.Fatalf("could not get current directory: %v\n", err)
+		logger.Errorf("could not get current directory: %v", err)
+		os.Exit(1)
 	}
 
-	cmd.Flags().StringVarP(&k8sVersion, "kubernetes-version", "k", types.NodeImageTag, "Desired version of Kubernetes")
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Target namespace")
-	cmd.Flags().StringVarP(&outputPath, "output-path", "o", currDir, "Output path for kubeconfig")
+	cmd.Flags().StringVarP(&k8sVersion, "kubernetes-version", "k", types.NodeImageTag, "Desired version of Kubernetes, such as 1.21.2, 1.21, latest or stable-N")
+	cmd.Flags().StringVarP(&outputPath, "output-path", "", currDir, "Output path for kubeconfig")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Print the cluster as json or yaml instead of the kubeconfig path")
 	cmd.Flags().StringVarP(&clusterName, "cluster-name", "", "", "The name for cluster")
 	cmd.Flags().IntVarP(&timeout, "timeout", "t", 240, "timeout for wait")
+	cmd.Flags().StringSliceVarP(&waitForInner, "wait-for-inner", "", []string{"nodes", "coredns", "default-sa"}, "Checks run with the kubeconfig before the cluster is declared ready, within --timeout, none disables them")
+	cmd.Flags().StringVarP(&image, "image", "", types.ImageRepository+":"+types.ImageTag, "Image of the kind-cluster container")
+	cmd.Flags().StringVarP(&nodeImageRepository, "node-image-repository", "", types.NodeImageRepository, "Repository of the KinD node images")
+	cmd.Flags().StringVarP(&nodeImage, "node-image", "", "", "Full reference of the KinD node image, overrides --kubernetes-version")
+	cmd.Flags().StringArrayVarP(&imagePullSecrets, "image-pull-secret", "", []string{}, "Name of the secret to pull the kind-cluster image")
+	cmd.Flags().StringVarP(&imagePullPolicy, "image-pull-policy", "", string(corev1.PullIfNotPresent), "Pull policy of the kind-cluster image")
+	cmd.Flags().DurationVarP(&ttl, "ttl", "", 0, "Time to live of the cluster, it is recorded on the pod")
+	cmd.Flags().StringVarP(&expose, "expose", "", "nodeport", "How the API server is exposed, nodeport or clusterip for clients running in the same cluster")
+	cmd.Flags().StringVarP(&owner, "owner", "", "", "Owner of the cluster, defaults to <user>_<hostname>")
+	cmd.Flags().StringVarP(&cpu, "cpu", "", "", "CPU request of the kind-cluster container")
+	cmd.Flags().StringVarP(&memory, "memory", "", "", "Memory request of the kind-cluster container")
+	cmd.Flags().StringVarP(&cpuLimit, "cpu-limit", "", "", "CPU limit of the kind-cluster container")
+	cmd.Flags().StringVarP(&memoryLimit, "memory-limit", "", "", "Memory limit of the kind-cluster container")
+	cmd.Flags().StringVarP(&compatMatrix, "compat-matrix", "", "", "Path to a file overriding the embedded compatibility matrix of kind-cluster images and node versions")
+	cmd.Flags().BoolVarP(&withRegistry, "with-registry", "", false, "Run a local registry which is wired into the KinD cluster")
+	cmd.Flags().StringArrayVarP(&registryMirrors, "registry-mirror", "", []string{}, "Registry mirror in the form of host=url for the Docker daemon and the KinD nodes, a bare url mirrors Docker Hub")
+	cmd.Flags().IntVarP(&count, "count", "", 1, "Number of clusters to create, they are named <name>-1, <name>-2 and so on")
+	cmd.Flags().StringVarP(&clustersFile, "filename", "f", "", "File listing the clusters to create, their fields override the flags")
+	cmd.Flags().IntVarP(&parallelism, "parallelism", "", 4, "Number of clusters created at the same time, 0 creates all of them at once")
+	cmd.Flags().BoolVarP(&atomic, "atomic", "", false, "Delete all the clusters if any of them could not be created")
+	cmd.Flags().StringVarP(&exportEnv, "export-env", "", "", "Append KUBECONFIG, KINK_CLUSTER, KINK_NAMESPACE and KINK_ENDPOINT to the file in dotenv format")
+	cmd.Flags().BoolVarP(&githubOutput, "github-output", "", false, "Append the same variables as --export-env to the outputs of the GitHub Actions step")
+	cmd.Flags().BoolVarP(&persistent, "persistent", "", false, "Keep the Docker storage on a PVC, so that the cluster could be stopped by \"kink stop\" and started again by \"kink start\"")
+	cmd.Flags().StringVarP(&storageSize, "storage-size", "", "20Gi", "Size of the PVC of --persistent")
+	cmd.Flags().StringVarP(&storageClass, "storage-class", "", "", "Storage class of the PVC of --persistent, the default class is used if it is empty")
+	cmd.Flags().StringVarP(&fromSnapshot, "from-snapshot", "", "", "Restore the cluster from a snapshot taken by \"kink snapshot\", a .tar.gz file or pvc/<claim>")
+	cmd.Flags().StringSliceVarP(&addonNames, "addon", "", []string{}, "Add-ons to enable once the cluster is ready, such as ingress-nginx,metrics-server,cert-manager, see \"kink addon list\"")
+	cmd.Flags().StringArrayVarP(&applyPaths, "apply", "", []string{}, "Manifest file, directory, kustomization or URL applied into the cluster once it is ready, could be repeated")
+	cmd.Flags().StringSliceVarP(&waitFor, "wait-for", "", []string{}, "Resources to wait for after applying the manifests, such as deployment/foo,kube-system/ds/bar,crd/baz.example.com")
+	cmd.Flags().DurationVarP(&waitTimeout, "wait-timeout", "", 5*time.Minute, "How long to wait for the add-ons and the resources of --wait-for")
+	cmd.Flags().StringArrayVarP(&insecureRegistries, "insecure-registry", "", []string{}, "Registry host whose TLS certificate should not be verified")
 
 	return cmd
 }
 
-func doExec(podName string, namespace string, command []string) (string, error) {
-	client, err := kubernetes.Client()
-	container := "kind-cluster"
-	if err != nil {
-		return "", fmt.Errorf("getting client config for Kubernetes client: %w", err)
-	}
-	execReq := client.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(namespace).
-		SubResource("exec").
-		Param("container", container)
-
-	execReq.VersionedParams(&corev1.PodExecOptions{
-		Container: container,
-		Command:   command,
-		Stdin:     false,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       false,
-	}, scheme.ParameterCodec)
-
-	var stdout, stderr bytes.Buffer
-	config, err := kubernetes.RestClientConfig()
-	if err != nil {
-		return "", err
-	}
-
-	err = execute("POST", execReq.URL(), config, nil, &stdout, &stderr, false)
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(stdout.String()), nil
-}
-
 func WriteFile(path string, data []byte, perm os.FileMode) error {
 	if index := strings.LastIndex(path, "/"); index != -1 {
 		dir := path[:index+1]
@@ -458,34 +348,444 @@ func WriteFile(path string, data []byte, perm os.FileMode) error {
 	return os.WriteFile(path, data, perm)
 }
 
-func execute(method string, url *url.URL, config *rest.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
-	exec, err := remotecommand.NewSPDYExecutor(config, method, url)
+// bootstrap enables the add-ons and applies the objects into the cluster, then waits for the resources
+// to be ready. The add-ons are enabled first since the objects may depend on them.
+func bootstrap(ctx context.Context, cluster *kink.Cluster, addons []addon.Addon, objs []*unstructured.Unstructured, waitFor []string, timeout time.Duration, logf func(string, ...interface{})) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if len(addons) > 0 {
+		installer, err := addon.NewInstaller(cluster)
+		if err != nil {
+			return err
+		}
+		installer.Logf = logf
+		if err := installer.Enable(ctx, addons); err != nil {
+			return fmt.Errorf("bootstrapping cluster %s: %w", cluster.Name, err)
+		}
+	}
+
+	restConfig, err := cluster.RESTConfig()
 	if err != nil {
 		return err
 	}
-	return exec.Stream(remotecommand.StreamOptions{
-		Stdin:  stdin,
-		Stdout: stdout,
-		Stderr: stderr,
-		Tty:    tty,
-	})
+
+	client, err := manifest.NewClient(restConfig)
+	if err != nil {
+		return err
+	}
+	client.Logf = logf
+
+	if err := client.ApplyObjects(ctx, objs); err != nil {
+		return fmt.Errorf("bootstrapping cluster %s: %w", cluster.Name, err)
+	}
+
+	if err := client.WaitFor(ctx, waitFor); err != nil {
+		return fmt.Errorf("bootstrapping cluster %s: %w", cluster.Name, err)
+	}
+
+	return nil
+}
+
+// looksLikePath returns true if the value exists as a path or has the form of one, such as ./out
+func looksLikePath(value string) bool {
+	if _, err := os.Stat(value); err == nil {
+		return true
+	}
+	return strings.ContainsRune(value, os.PathSeparator) || strings.Contains(value, "/") ||
+		strings.HasPrefix(value, ".") || strings.HasPrefix(value, "~")
 }
 
-func isContainersReady(pod corev1.Pod) bool {
-	for _, cs := range pod.Status.ContainerStatuses {
-		if cs.Ready {
-			return true
+// clusterEnv returns the environment variables describing the clusters for the later CI jobs, the
+// values of multiple clusters are separated by spaces
+func clusterEnv(clusters []*kink.Cluster) [][2]string {
+	var names, namespaces, endpoints []string
+	for _, c := range clusters {
+		names = append(names, c.Name)
+		namespaces = append(namespaces, c.Namespace)
+		endpoints = append(endpoints, c.Endpoint)
+	}
+
+	return [][2]string{
+		{"KUBECONFIG", clusters[0].KubeconfigPath},
+		{"KINK_CLUSTER", strings.Join(names, " ")},
+		{"KINK_NAMESPACE", strings.Join(namespaces, " ")},
+		{"KINK_ENDPOINT", strings.Join(endpoints, " ")},
+	}
+}
+
+// writeEnv appends the variables to the file in dotenv format, which is also the format of GitHub
+// Actions outputs
+func writeEnv(path string, env [][2]string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range env {
+		if _, err := fmt.Fprintf(f, "%s=%s\n", e[0], e[1]); err != nil {
+			_ = f.Close()
+			return err
 		}
 	}
-	return false
+
+	return f.Close()
 }
 
-func ptrbool(p bool) *bool {
-	return &p
+// printResult prints the created clusters in the output format, or only their kubeconfig path if it
+// is empty. A single cluster is printed as an object, multiple ones as a list.
+func printResult(clusters []*kink.Cluster, output string) error {
+	var result interface{} = clusters
+	if len(clusters) == 1 {
+		result = clusters[0]
+	}
+
+	var data []byte
+	var err error
+	switch output {
+	case "":
+		fmt.Println(clusters[0].KubeconfigPath)
+		return nil
+	case "json":
+		data, err = json.MarshalIndent(result, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(result)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// mergeKubeconfigs merges the kubeconfigs of the clusters into the file, which holds a context per cluster
+func mergeKubeconfigs(kubeconfigPath string, clusters []*kink.Cluster) error {
+	dname, err := ioutil.TempDir("", "kink_kubeconfig")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dname)
+
+	kubeConfigs := []string{kubeconfigPath}
+	for _, c := range clusters {
+		tmpKubeconfigPath := filepath.Join(dname, c.Namespace+"_"+c.Name)
+		err = WriteFile(tmpKubeconfigPath, c.Kubeconfig, 0o600)
+		if err != nil {
+			return err
+		}
+
+		logger.Debugf("KUBECONFIG file has been written to the directory: %s", tmpKubeconfigPath)
+		kubeConfigs = append(kubeConfigs, tmpKubeconfigPath)
+	}
+
+	rules := clientcmd.ClientConfigLoadingRules{
+		Precedence: kubeConfigs,
+	}
+
+	mergedConfig, err := rules.Load()
+	if err != nil {
+		return err
+	}
+
+	encode, err := runtime.Encode(clientcmdapilatest.Codec, mergedConfig)
+	if err != nil {
+		return err
+	}
+
+	merged, err := yaml.JSONToYAML(encode)
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(kubeconfigPath, merged, 0o600)
+}
+
+// runSpecs returns the specs of the clusters to create from the name argument, --count or the cluster file
+func runSpecs(base kink.Spec, args []string, count int, clustersFile string) ([]kink.Spec, error) {
+	if clustersFile == "" {
+		if count == 1 {
+			base.Name = args[0]
+			return []kink.Spec{base}, nil
+		}
+
+		var specs []kink.Spec
+		for i := 1; i <= count; i++ {
+			spec := base
+			spec.Name = fmt.Sprintf("%s-%d", args[0], i)
+			if base.ClusterName != "" {
+				spec.ClusterName = fmt.Sprintf("%s-%d", base.ClusterName, i)
+			}
+			specs = append(specs, spec)
+		}
+		return specs, nil
+	}
+
+	f, err := config.LoadClusterFile(clustersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []kink.Spec
+	for _, entry := range f.Clusters {
+		spec, err := specFromEntry(base, entry)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", entry.Name, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// specFromEntry returns the spec of the flags overridden by the fields of the cluster file entry
+func specFromEntry(spec kink.Spec, e config.ClusterEntry) (kink.Spec, error) {
+	spec.Name = e.Name
+	// the cluster name of the flags could not be shared
+	spec.ClusterName = e.ClusterName
+
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	setString(&spec.Namespace, e.Namespace)
+	setString(&spec.Image, e.Image)
+	setString(&spec.NodeImageRepository, e.NodeImageRepository)
+	setString(&spec.NodeImage, e.NodeImage)
+	setString(&spec.KubernetesVersion, e.KubernetesVersion)
+
+	if e.ImagePullPolicy != "" {
+		spec.ImagePullPolicy = corev1.PullPolicy(e.ImagePullPolicy)
+	}
+	if e.Expose != "" {
+		spec.Expose = kink.ExposeMode(e.Expose)
+	}
+	if len(e.ImagePullSecrets) > 0 {
+		spec.ImagePullSecrets = e.ImagePullSecrets
+	}
+	if e.Timeout > 0 {
+		spec.Timeout = time.Duration(e.Timeout) * time.Second
+	}
+	if e.Resources != nil {
+		spec.Resources = *e.Resources
+	}
+	if e.WithRegistry != nil {
+		spec.WithRegistry = *e.WithRegistry
+	}
+
+	if e.TTL != "" {
+		ttl, err := time.ParseDuration(e.TTL)
+		if err != nil {
+			return spec, fmt.Errorf("invalid ttl %q: %w", e.TTL, err)
+		}
+		spec.TTL = ttl
+	}
+
+	if e.Owner != "" {
+		owner, err := runnedBy(e.Owner)
+		if err != nil {
+			return spec, err
+		}
+		spec.Owner = owner
+	}
+
+	if e.CompatMatrix != "" {
+		matrix, err := compat.Load(e.CompatMatrix)
+		if err != nil {
+			return spec, err
+		}
+		spec.CompatMatrix = matrix
+	}
+
+	return spec, nil
+}
+
+// createClusters creates the clusters concurrently, at most parallelism of them at a time, and bootstraps
+// each one once it is created. The created clusters are returned along with the errors of the others,
+// unless atomic is true which deletes all of them if any of them fails to be created or bootstrapped.
+func createClusters(ctx context.Context, specs []kink.Spec, parallelism int, atomic bool,
+	bootstrapCluster func(context.Context, *kink.Cluster, func(string, ...interface{})) error) ([]*kink.Cluster, error) {
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	progress := newMultiProgress(names)
+
+	if parallelism < 1 || parallelism > len(specs) {
+		parallelism = len(specs)
+	}
+
+	// the other clusters are cancelled as soon as one of them fails if the creation is atomic
+	createCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, parallelism)
+	created := make([]*kink.Cluster, len(specs))
+	errs := make([]error, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func(i int, spec kink.Spec) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-createCtx.Done():
+				errs[i] = createCtx.Err()
+				progress.set(i, "cancelled")
+				return
+			}
+
+			client, err := newClient()
+			if err != nil {
+				errs[i] = err
+				progress.set(i, "failed")
+				return
+			}
+			client.Logf = func(format string, args ...interface{}) {
+				progress.logf(i, format, args...)
+			}
+
+			elapsed := 0
+			progress.set(i, "creating")
+			spec.Progress = func() {
+				progress.update(i, fmt.Sprintf("creating %ds/%ds", elapsed, int(spec.Timeout.Seconds())))
+				elapsed++
+			}
+
+			cluster, err := client.Create(createCtx, spec)
+			if err != nil {
+				errs[i] = err
+				progress.set(i, "failed")
+				if atomic {
+					cancel()
+				}
+				return
+			}
+
+			created[i] = cluster
+			progress.set(i, "bootstrapping")
+			if err := bootstrapCluster(createCtx, cluster, client.Logf); err != nil {
+				errs[i] = err
+				progress.set(i, "failed")
+				if atomic {
+					cancel()
+				}
+				return
+			}
+			progress.set(i, "ready")
+		}(i, spec)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, err := range errs {
+		// the clusters cancelled because of another one are not worth reporting
+		if err == nil || (errors.Is(err, context.Canceled) && ctx.Err() == nil) {
+			continue
+		}
+		failed = append(failed, err.Error())
+	}
+
+	var clusters []*kink.Cluster
+	for _, c := range created {
+		if c != nil {
+			clusters = append(clusters, c)
+		}
+	}
+
+	if len(failed) == 0 {
+		return clusters, nil
+	}
+	err := errors.New(strings.Join(failed, "\n"))
+
+	if !atomic {
+		return clusters, err
+	}
+
+	client, clientErr := newClient()
+	if clientErr != nil {
+		return nil, fmt.Errorf("%w\ncould not roll back the created clusters: %v", err, clientErr)
+	}
+
+	rollbackCtx, rollbackCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer rollbackCancel()
+	for i, c := range created {
+		if c == nil {
+			continue
+		}
+
+		if deleteErr := client.Delete(rollbackCtx, c.Namespace, c.Name, false); deleteErr != nil {
+			progress.set(i, "could not be rolled back")
+			err = fmt.Errorf("%w\ncould not roll back: %v", err, deleteErr)
+			continue
+		}
+		progress.set(i, "rolled back")
+	}
+
+	return nil, err
+}
+
+// rollbackCluster deletes the cluster which is created but failed to be bootstrapped, the context of the
+// command is not used since it may have been cancelled
+func rollbackCluster(client *kink.Client, cluster *kink.Cluster, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if deleteErr := client.Delete(ctx, cluster.Namespace, cluster.Name, false); deleteErr != nil {
+		return fmt.Errorf("%w\ncould not roll back: %v", err, deleteErr)
+	}
+	logger.Infof("Pod %s and Service %s are rolled back", cluster.Name, cluster.Name)
+	return err
+}
+
+// resourceRequirements returns the resources of the kind-cluster container
+func resourceRequirements(cpu, memory, cpuLimit, memoryLimit string) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{}
+	for _, r := range []struct {
+		list  *corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{&resources.Requests, corev1.ResourceCPU, cpu},
+		{&resources.Requests, corev1.ResourceMemory, memory},
+		{&resources.Limits, corev1.ResourceCPU, cpuLimit},
+		{&resources.Limits, corev1.ResourceMemory, memoryLimit},
+	} {
+		if r.value == "" {
+			continue
+		}
+
+		q, err := resource.ParseQuantity(r.value)
+		if err != nil {
+			return resources, fmt.Errorf("invalid %s quantity %q: %w", r.name, r.value, err)
+		}
+
+		if *r.list == nil {
+			*r.list = corev1.ResourceList{}
+		}
+		(*r.list)[r.name] = q
+	}
+
+	return resources, nil
+}
+
+// runnedBy returns the value of the runned-by label which is used to find the clusters of the owner
+func runnedBy(owner string) (string, error) {
+	if owner != "" {
+		if errs := validation.IsValidLabelValue(owner); len(errs) > 0 {
+			return "", fmt.Errorf("invalid owner %q: %s", owner, strings.Join(errs, ", "))
+		}
+		return owner, nil
+	}
+
+	return kink.DefaultOwner()
 }
 
 func init() {
-	rootCmd.AddCommand(NewCmdRun())
+	rootCmd.AddCommand(withProfile(NewCmdRun()))
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdSnapshot represents the snapshot command
+func NewCmdSnapshot() *cobra.Command {
+	var to string
+
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save a snapshot of a cluster",
+		Long: `Save the KinD nodes of the cluster along with everything installed into them, the cluster could be
+restored by "kink run --from-snapshot". The nodes are stopped while they are saved.
+		usage: kink snapshot <name> --to snapshot.tar.gz|pvc/<claim>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the cluster as an argument")
+			}
+			if to == "" {
+				return errors.New("please provide the destination of the snapshot with --to")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			source := parseSnapshotSource(to)
+			var info *kink.SnapshotInfo
+			if source.Claim != "" {
+				info, err = client.SnapshotToClaim(cmd.Context(), namespace, args[0], source.Claim)
+			} else {
+				info, err = snapshotToFile(cmd, client, namespace, args[0], source.File)
+			}
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("Snapshot of cluster %s (%s) is saved to %s, restore it by running the following command:\n$ kink run <name> --from-snapshot %s", args[0], info.NodeImage, to, to)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&to, "to", "", "", "Destination of the snapshot, a .tar.gz file or pvc/<claim> for an existing PVC")
+
+	return cmd
+}
+
+// snapshotToFile writes the snapshot to the file, the file is removed if the snapshot fails
+func snapshotToFile(cmd *cobra.Command, client *kink.Client, namespace, name, path string) (*kink.SnapshotInfo, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bar := newProgressBar(-1, fmt.Sprintf("[cyan][1/1][reset] Saving snapshot of %s...", name))
+	info, err := client.Snapshot(cmd.Context(), namespace, name, io.MultiWriter(f, bar))
+	_ = bar.Finish()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// parseSnapshotSource parses a snapshot file or pvc/<claim>
+func parseSnapshotSource(s string) *kink.SnapshotSource {
+	if claim := strings.TrimPrefix(s, "pvc/"); claim != s {
+		return &kink.SnapshotSource{Claim: claim}
+	}
+	return &kink.SnapshotSource{File: s}
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdSnapshot()))
+}
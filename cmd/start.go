@@ -0,0 +1,100 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdStart represents the start command
+func NewCmdStart() *cobra.Command {
+	var outputPath, output string
+	var timeout int
+
+	currDir, err := os.Getwd()
+	if err != nil {
+		logger.Errorf("could not get current directory: %v", err)
+		os.Exit(1)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start a stopped cluster",
+		Long: `Recreate the pod of a cluster stopped by "kink stop", the KinD nodes are started again with their
+state and the kubeconfig is written again since the address of the cluster may change
+		usage: kink start <name>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the cluster as an argument")
+			}
+
+			if output != "" && output != "json" && output != "yaml" {
+				return fmt.Errorf("invalid output format %q, it should be json or yaml", output)
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			bar := newProgressBar(int64(timeout), fmt.Sprintf("[cyan][1/1][reset] Starting Pod %s...", args[0]))
+			cluster, err := client.Start(cmd.Context(), namespace, args[0], kink.StartOptions{
+				Timeout: time.Duration(timeout) * time.Second,
+				Progress: func() {
+					_ = bar.Add(1)
+				},
+			})
+			if err != nil {
+				return err
+			}
+			_ = bar.Finish()
+
+			kubeconfigPath := filepath.Join(outputPath, "kubeconfig")
+			if err := mergeKubeconfigs(kubeconfigPath, []*kink.Cluster{cluster}); err != nil {
+				return err
+			}
+			cluster.KubeconfigPath = kubeconfigPath
+
+			logger.Infof("Cluster %s is started, KUBECONFIG file generated at path '%s'", args[0], kubeconfigPath)
+			return printResult([]*kink.Cluster{cluster}, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputPath, "output-path", "", currDir, "Output path for kubeconfig")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Print the cluster as json or yaml instead of the kubeconfig path")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 240, "timeout for wait")
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdStart()))
+}
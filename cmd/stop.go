@@ -0,0 +1,64 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdStop represents the stop command
+func NewCmdStop() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop a cluster without losing its state",
+		Long: `Stop the KinD nodes and delete the pod of a cluster created with "kink run --persistent" to free
+its resources, its Service and its PVC are kept to start it again by "kink start"
+		usage: kink stop <name>`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("please provide the name of the cluster as an argument")
+			}
+
+			namespace, _, err := kubernetes.DefaultClientConfig().Namespace()
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			if err := client.Stop(cmd.Context(), namespace, args[0]); err != nil {
+				return err
+			}
+
+			logger.Infof("Cluster %s is stopped, start it again by running the following command:\n$ kink start %s", args[0], args[0])
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(withProfile(NewCmdStop()))
+}
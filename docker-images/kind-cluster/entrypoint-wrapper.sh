@@ -11,10 +11,17 @@ while [ ! -f /dockerd-ready ]; do sleep 1; done
 echo "Setting up KIND cluster"
 
 # Startup a KIND cluster with given configurations
+# The API server listens on all the addresses of the pod, so that the KinD nodes could be started again
+# on a pod with another address by "kink start"
 API_SERVER_ADDRESS=${API_SERVER_ADDRESS:-"127.0.0.1"}
-sed -i "s/apiServerAddress:$/apiServerAddress: ${API_SERVER_ADDRESS}/" kind-config.yaml
+sed -i "s/apiServerAddress:$/apiServerAddress: 0.0.0.0/" kind-config.yaml
+
+# Newer Kubernetes versions reject the v1beta2 kubeadm API, kink picks the version the node image accepts
+KUBEADM_API_VERSION=${KUBEADM_API_VERSION:-"v1beta2"}
+sed -i "s#kubeadm.k8s.io/v1beta2#kubeadm.k8s.io/${KUBEADM_API_VERSION}#" kind-config.yaml
 
 CERT_SANS=(${CERT_SANS:-""})
+CERT_SANS+=(${EXTRA_CERT_SANS:-""})
 CERT_SANS+=(${API_SERVER_ADDRESS})
 CERT_SANS+=($(hostname -i))
 CERT_SANS+=(localhost)
@@ -25,7 +32,7 @@ UNIQUE_CERT_SANS=($(echo "${CERT_SANS[@]}" | tr ' ' '\n' | sort -u | tr '\n' ' '
 for hostname in "${UNIQUE_CERT_SANS[@]}"; do
 cat <<EOF >> kind-config.yaml
 - group: kubeadm.k8s.io
-  version: v1beta2
+  version: ${KUBEADM_API_VERSION}
   kind: ClusterConfiguration
   patch: |
     - op: add
@@ -34,6 +41,118 @@ cat <<EOF >> kind-config.yaml
 EOF
 done
 
-kind create cluster --name=${KIND_CLUSTER_NAME:-""} --config=kind-config.yaml --image=${KIND_NODE_IMAGE-"trendyoltech/kind-node:v1.21.2"} --wait=900s
+# Startup a local registry which is reachable from the KinD nodes, see:
+# https://kind.sigs.k8s.io/docs/user/local-registry/
+KIND_REGISTRY_ENABLED=${KIND_REGISTRY_ENABLED:-"false"}
+KIND_REGISTRY_NAME=${KIND_REGISTRY_NAME:-"kind-registry"}
+KIND_REGISTRY_PORT=${KIND_REGISTRY_PORT:-"5001"}
+if [ "${KIND_REGISTRY_ENABLED}" == "true" ]; then
+  echo "Setting up local registry"
+  docker start "${KIND_REGISTRY_NAME}" > /dev/null 2>&1 || docker run -d --restart=always -p "0.0.0.0:${KIND_REGISTRY_PORT}:5000" --name "${KIND_REGISTRY_NAME}" \
+    "${KIND_REGISTRY_IMAGE:-"registry:2"}"
+fi
+
+# Containerd configuration patches are rendered by kink as a TOML document
+if [ -n "${KIND_CONTAINERD_CONFIG_PATCH:-""}" ]; then
+cat <<EOF >> kind-config.yaml
+containerdConfigPatches:
+- |-
+$(echo "${KIND_CONTAINERD_CONFIG_PATCH}" | sed 's/^/  /')
+EOF
+fi
+
+# The ports of the control-plane node are published on the pod, such as the host ports of an ingress controller
+KIND_EXTRA_PORTS=(${KIND_EXTRA_PORTS:-""})
+if [ "${#KIND_EXTRA_PORTS[@]}" -gt 0 ]; then
+cat <<EOF >> kind-config.yaml
+nodes:
+- role: control-plane
+  extraPortMappings:
+EOF
+for port in "${KIND_EXTRA_PORTS[@]}"; do
+cat <<EOF >> kind-config.yaml
+  - containerPort: ${port}
+    hostPort: ${port}
+    listenAddress: 0.0.0.0
+EOF
+done
+fi
+
+KIND_CLUSTER_NAME=${KIND_CLUSTER_NAME:-"kind"}
+
+# Restore the KinD nodes from a snapshot taken by "kink snapshot", kink uploads it unless it is on a PVC
+KINK_SNAPSHOT_DIR=${KINK_SNAPSHOT_DIR:-""}
+if [ -n "${KINK_SNAPSHOT_DIR}" ]; then
+  echo "Waiting for the snapshot"
+  while [ ! -f "${KINK_SNAPSHOT_DIR}/ready" ]; do sleep 1; done
+
+  echo "Restoring KIND cluster from the snapshot"
+  docker load -i "${KINK_SNAPSHOT_DIR}/images.tar"
+  docker network create kind --subnet "$(cat "${KINK_SNAPSHOT_DIR}/network")" \
+    -o com.docker.network.bridge.enable_ip_masquerade=true
+
+  # The nodes are created the way KinD creates them, they keep their addresses in the snapshot
+  while read -r node role ip; do
+    image="kink-snapshot/${node}:latest"
+    publish=()
+    if [ "${role}" == "control-plane" ]; then
+      publish=(--publish "0.0.0.0:30001:6443/TCP")
+      for port in "${KIND_EXTRA_PORTS[@]}"; do
+        publish+=(--publish "0.0.0.0:${port}:${port}/TCP")
+      done
+    fi
+    docker create --name "${node}" --hostname "${node}" \
+      --label io.x-k8s.kind.cluster="${KIND_CLUSTER_NAME}" --label io.x-k8s.kind.role="${role}" \
+      --privileged --security-opt seccomp=unconfined --security-opt apparmor=unconfined \
+      --tmpfs /tmp --tmpfs /run --volume /var --volume /lib/modules:/lib/modules:ro \
+      --tty --net kind --ip "${ip}" --restart=on-failure:1 --init=false \
+      "${publish[@]}" "${image}"
+    docker run --rm --volumes-from "${node}" -v "${KINK_SNAPSHOT_DIR}:/snapshot:ro" --entrypoint tar "${image}" \
+      -C /var -xf "/snapshot/${node}-var.tar"
+  done < "${KINK_SNAPSHOT_DIR}/nodes"
+fi
+
+NODES=$(docker ps -aq --filter "label=io.x-k8s.kind.cluster=${KIND_CLUSTER_NAME}")
+if [ -n "${NODES}" ]; then
+  echo "Starting the existing KIND cluster"
+  docker start ${NODES}
+
+  # The addresses of the pod may have changed, so the certificate of the API server is issued again
+  CONTROL_PLANE="${KIND_CLUSTER_NAME}-control-plane"
+  EXTRA_SANS=$(echo "${CONTROL_PLANE} ${UNIQUE_CERT_SANS[*]}" | tr ' ' ',')
+  docker exec "${CONTROL_PLANE}" bash -c "rm -f /etc/kubernetes/pki/apiserver.crt /etc/kubernetes/pki/apiserver.key && \
+    kubeadm init phase certs apiserver --kubernetes-version \"\$(kubeadm version -o short)\" \
+      --apiserver-advertise-address \"\$(hostname -i)\" --service-cidr 10.246.0.0/16 \
+      --apiserver-cert-extra-sans ${EXTRA_SANS}"
+
+  until docker exec "${CONTROL_PLANE}" kubectl --kubeconfig=/etc/kubernetes/admin.conf get --raw /readyz > /dev/null 2>&1; do
+    sleep 1
+  done
+  docker exec "${CONTROL_PLANE}" kubectl --kubeconfig=/etc/kubernetes/admin.conf wait --for=condition=Ready nodes --all --timeout=900s
+
+  kind export kubeconfig --name "${KIND_CLUSTER_NAME}"
+else
+  kind create cluster --name=${KIND_CLUSTER_NAME} --config=kind-config.yaml --image=${KIND_NODE_IMAGE-"trendyoltech/kind-node:v1.21.2"} --wait=900s
+fi
+
+# The kubeconfig points to the address of the pod, kink replaces it with the address of the Service
+kubectl config set-cluster "kind-${KIND_CLUSTER_NAME}" --server "https://${API_SERVER_ADDRESS}:30001"
+
+if [ "${KIND_REGISTRY_ENABLED}" == "true" ]; then
+  docker network connect kind "${KIND_REGISTRY_NAME}" || true
+
+  # Document the local registry for the tools running in the cluster
+  cat <<EOF | kubectl apply -f -
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "localhost:${KIND_REGISTRY_PORT}"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+EOF
+fi
 
 exec "$@"
@@ -0,0 +1,343 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package addon installs the curated add-ons into the KinD clusters along with the settings KinD
+// requires for them.
+package addon
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	"github.com/Trendyol/kink/pkg/manifest"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+//go:embed manifests
+var manifests embed.FS
+
+// stateConfigMap records the add-ons enabled in the cluster with their versions
+const stateConfigMap = "kink-addons"
+
+var (
+	// ErrUnknownAddon is returned for the names which are not in the catalog
+	ErrUnknownAddon = errors.New("unknown add-on")
+	// ErrCreationOnly is returned if an add-on requires a setting the cluster is not created with
+	ErrCreationOnly = errors.New("add-on could only be enabled at creation")
+	// ErrUnreachable is returned for the clusters exposed by ClusterIP, which kink could not reach
+	ErrUnreachable = errors.New("add-ons could not be managed in the clusters exposed by clusterip")
+)
+
+// Addon is a curated add-on
+type Addon struct {
+	Name        string
+	Version     string
+	Description string
+	// Ports of the KinD control-plane node the add-on listens on, they are published at creation
+	Ports []int32
+	// NodeLabels are put on the KinD control-plane node before installing the add-on
+	NodeLabels map[string]string
+	// Registry is true for the local registry, which is run next to the KinD cluster rather than in it
+	Registry bool
+	// WaitFor are the resources which are ready once the add-on is, see manifest.Client.WaitFor
+	WaitFor []string
+}
+
+var catalog = []Addon{
+	{
+		Name:        "cert-manager",
+		Version:     "v1.5.4",
+		Description: "Issues the certificates of the Certificate resources",
+		WaitFor: []string{
+			"cert-manager/deployment/cert-manager",
+			"cert-manager/deployment/cert-manager-cainjector",
+			"cert-manager/deployment/cert-manager-webhook",
+		},
+	},
+	{
+		Name:        "ingress-nginx",
+		Version:     "v1.0.4",
+		Description: "Serves the Ingresses on the ports 80 and 443 of the pod and the Service of the cluster",
+		Ports:       []int32{80, 443},
+		NodeLabels:  map[string]string{"ingress-ready": "true"},
+		WaitFor:     []string{"ingress-nginx/deployment/ingress-nginx-controller"},
+	},
+	{
+		Name:        "metrics-server",
+		Version:     "v0.5.1",
+		Description: "Serves the resource metrics for kubectl top and the HorizontalPodAutoscalers",
+		WaitFor:     []string{"kube-system/deployment/metrics-server"},
+	},
+	{
+		Name:        "registry",
+		Version:     "builtin",
+		Description: "Local registry wired into the KinD cluster, the same as --with-registry",
+		Registry:    true,
+	},
+}
+
+// List returns the add-ons in the catalog
+func List() []Addon {
+	return append([]Addon(nil), catalog...)
+}
+
+// Get returns the add-ons of the names
+func Get(names []string) ([]Addon, error) {
+	var addons []Addon
+	for _, n := range names {
+		a, ok := find(n)
+		if !ok {
+			var known []string
+			for _, a := range catalog {
+				known = append(known, a.Name)
+			}
+			return nil, fmt.Errorf("%w %q, it should be one of %s", ErrUnknownAddon, n, strings.Join(known, ", "))
+		}
+		addons = append(addons, a)
+	}
+	return addons, nil
+}
+
+func find(name string) (Addon, bool) {
+	for _, a := range catalog {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Addon{}, false
+}
+
+// Configure sets the fields of the spec the add-ons require at creation
+func Configure(spec *kink.Spec, addons []Addon) {
+	for _, a := range addons {
+		if a.Registry {
+			spec.WithRegistry = true
+		}
+		for _, p := range a.Ports {
+			if !containsPort(spec.Ports, p) {
+				spec.Ports = append(spec.Ports, p)
+			}
+		}
+	}
+}
+
+// Objects returns the objects of the add-on from its embedded kustomization, which vendors the upstream
+// manifest of its version so that nothing is fetched.
+func (a Addon) Objects() ([]*unstructured.Unstructured, error) {
+	if a.Registry {
+		return nil, nil
+	}
+	return manifest.ReadKustomization(manifests, "manifests/"+a.Name)
+}
+
+// Installer enables and disables the add-ons of a cluster
+type Installer struct {
+	cluster   *kink.Cluster
+	clientset kubernetes.Interface
+	manifests *manifest.Client
+
+	// Logf receives the diagnostic messages, they are discarded if it is nil
+	Logf func(format string, args ...interface{})
+}
+
+// NewInstaller returns the installer of the add-ons of the cluster, which should be ready
+func NewInstaller(cluster *kink.Cluster) (*Installer, error) {
+	if cluster.Expose == kink.ExposeClusterIP {
+		return nil, ErrUnreachable
+	}
+
+	restConfig, err := cluster.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := manifest.NewClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Installer{cluster: cluster, clientset: clientset, manifests: manifests}, nil
+}
+
+func (i *Installer) logf(format string, args ...interface{}) {
+	if i.Logf != nil {
+		i.Logf(format, args...)
+	}
+}
+
+// Enable installs the add-ons and waits for them to be ready. ErrCreationOnly is returned before
+// installing any of them if the cluster is not created with the settings they require.
+func (i *Installer) Enable(ctx context.Context, addons []Addon) error {
+	for _, a := range addons {
+		if a.Registry && i.cluster.Registry == "" {
+			return fmt.Errorf("%s: %w, create the cluster with --addon %s", a.Name, ErrCreationOnly, a.Name)
+		}
+		for _, p := range a.Ports {
+			if !containsPort(i.cluster.Ports, p) {
+				return fmt.Errorf("%s requires the port %d of the KinD node to be published: %w, create the cluster with --addon %s",
+					a.Name, p, ErrCreationOnly, a.Name)
+			}
+		}
+	}
+
+	i.manifests.Logf = i.Logf
+	for _, a := range addons {
+		i.logf("enabling add-on %s\n", a.Name)
+
+		objs, err := a.Objects()
+		if err != nil {
+			return fmt.Errorf("enabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.labelNode(ctx, a.NodeLabels); err != nil {
+			return fmt.Errorf("enabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.manifests.ApplyObjects(ctx, objs); err != nil {
+			return fmt.Errorf("enabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.manifests.WaitFor(ctx, a.WaitFor); err != nil {
+			return fmt.Errorf("enabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.record(ctx, a.Name, a.Version); err != nil {
+			return fmt.Errorf("enabling add-on %s: %w", a.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Disable deletes the objects of the add-ons, the settings made at creation such as the published
+// ports are kept
+func (i *Installer) Disable(ctx context.Context, addons []Addon) error {
+	i.manifests.Logf = i.Logf
+	for _, a := range addons {
+		i.logf("disabling add-on %s\n", a.Name)
+		if a.Registry {
+			i.logf("the local registry runs next to the KinD cluster, it is kept until the cluster is deleted\n")
+		}
+
+		objs, err := a.Objects()
+		if err != nil {
+			return fmt.Errorf("disabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.manifests.DeleteObjects(ctx, objs); err != nil {
+			return fmt.Errorf("disabling add-on %s: %w", a.Name, err)
+		}
+
+		if err := i.record(ctx, a.Name, ""); err != nil {
+			return fmt.Errorf("disabling add-on %s: %w", a.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Enabled returns the versions of the add-ons enabled in the cluster by their names
+func (i *Installer) Enabled(ctx context.Context) (map[string]string, error) {
+	cm, err := i.clientset.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, stateConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := map[string]string{}
+	for k, v := range cm.Data {
+		enabled[k] = v
+	}
+	return enabled, nil
+}
+
+// record records the version of the enabled add-on, an empty version removes the add-on
+func (i *Installer) record(ctx context.Context, name, version string) error {
+	configMaps := i.clientset.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	cm, err := configMaps.Get(ctx, stateConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if version == "" {
+			return nil
+		}
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: stateConfigMap, Namespace: metav1.NamespaceSystem},
+			Data:       map[string]string{name: version},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if version == "" {
+		delete(cm.Data, name)
+	} else {
+		cm.Data[name] = version
+	}
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// labelNode puts the labels on the control-plane node of the KinD cluster
+func (i *Installer) labelNode(ctx context.Context, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	nodes := i.clientset.CoreV1().Nodes()
+	node, err := nodes.Get(ctx, i.cluster.ClusterName+"-control-plane", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("labelling node: %w", err)
+	}
+
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		node.Labels[k] = v
+	}
+	if _, err := nodes.Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("labelling node: %w", err)
+	}
+	return nil
+}
+
+func containsPort(ports []int32, port int32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
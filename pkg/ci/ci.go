@@ -0,0 +1,91 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ci detects the CI job kink runs in.
+package ci
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Trendyol/kink/pkg/types"
+)
+
+// Job identifies the CI job, the empty fields are not known
+type Job struct {
+	Pipeline string
+	Job      string
+	Commit   string
+}
+
+// provider reads the job from the well-known environment variables of a CI system
+type provider struct {
+	// detect is the variable which is set to "true" by the CI system
+	detect                string
+	pipeline, job, commit string
+}
+
+var providers = []provider{
+	{detect: "GITLAB_CI", pipeline: "CI_PIPELINE_ID", job: "CI_JOB_ID", commit: "CI_COMMIT_SHA"},
+	{detect: "GITHUB_ACTIONS", pipeline: "GITHUB_RUN_ID", job: "GITHUB_JOB", commit: "GITHUB_SHA"},
+	{detect: "TF_BUILD", pipeline: "BUILD_BUILDID", job: "SYSTEM_JOBID", commit: "BUILD_SOURCEVERSION"},
+	{detect: "CIRCLECI", pipeline: "CIRCLE_WORKFLOW_ID", job: "CIRCLE_BUILD_NUM", commit: "CIRCLE_SHA1"},
+}
+
+// Detect returns the CI job kink runs in, ok is false if it does not run in a known CI system
+func Detect() (job Job, ok bool) {
+	for _, p := range providers {
+		if !strings.EqualFold(os.Getenv(p.detect), "true") {
+			continue
+		}
+
+		return Job{
+			Pipeline: os.Getenv(p.pipeline),
+			Job:      os.Getenv(p.job),
+			Commit:   os.Getenv(p.commit),
+		}, true
+	}
+
+	return Job{}, false
+}
+
+// Labels returns the labels identifying the job on the clusters it creates
+func (j Job) Labels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range map[string]string{
+		types.CIPipelineLabel: j.Pipeline,
+		types.CIJobLabel:      j.Job,
+		types.CICommitLabel:   j.Commit,
+	} {
+		if v := LabelValue(value); v != "" {
+			labels[key] = v
+		}
+	}
+	return labels
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// LabelValue turns the value into a valid label value by replacing the invalid characters and
+// truncating it to 63 characters
+func LabelValue(value string) string {
+	v := invalidLabelChars.ReplaceAllString(value, "-")
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return strings.Trim(v, "-_.")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Trendyol/kink/pkg/types"
+)
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "12345", want: "12345"},
+		{in: "build #42", want: "build-42"},
+		{in: "feature/foo bar", want: "feature-foo-bar"},
+		{in: "-._job_.-", want: "job"},
+		{in: "a:::b", want: "a-b"},
+		{in: "", want: ""},
+		{in: "///", want: ""},
+		{in: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+		{in: strings.Repeat("a", 62) + "/b", want: strings.Repeat("a", 62)},
+	}
+
+	for _, tt := range tests {
+		if got := LabelValue(tt.in); got != tt.want {
+			t.Errorf("LabelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJobLabels(t *testing.T) {
+	job := Job{Pipeline: "1234", Job: "e2e tests", Commit: ""}
+	want := map[string]string{
+		types.CIPipelineLabel: "1234",
+		types.CIJobLabel:      "e2e-tests",
+	}
+	if got := job.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels() = %v, want %v", got, want)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, p := range providers {
+		t.Setenv(p.detect, "")
+	}
+
+	if _, ok := Detect(); ok {
+		t.Fatal("Detect() should not find a job outside of a CI system")
+	}
+
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_PIPELINE_ID", "1234")
+	t.Setenv("CI_JOB_ID", "5678")
+	t.Setenv("CI_COMMIT_SHA", "abcdef")
+	job, ok := Detect()
+	if want := (Job{Pipeline: "1234", Job: "5678", Commit: "abcdef"}); !ok || job != want {
+		t.Errorf("Detect() = %v, %v, want %v, true", job, ok, want)
+	}
+}
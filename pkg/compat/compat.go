@@ -0,0 +1,192 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compat
+
+import (
+	// Embed the default compatibility matrix
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Trendyol/kink/pkg/versions"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+//go:embed matrix.yaml
+var defaultMatrix []byte
+
+// DefaultKubeadmAPIVersion is used for the node versions which are not listed in the matrix
+const DefaultKubeadmAPIVersion = "v1beta2"
+
+// Features of kink which need the support of the wrapper of the kind-cluster image
+const (
+	// FeatureSnapshot is restoring the KinD nodes from a snapshot
+	FeatureSnapshot = "snapshot"
+	// FeaturePersistent is starting the KinD nodes again on the PVC of a stopped cluster
+	FeaturePersistent = "persistent"
+	// FeaturePorts is publishing the ports of the KinD control-plane node, such as the ones of the add-ons
+	FeaturePorts = "ports"
+)
+
+// Matrix maps the kind-cluster images to the KinD release they bundle and the node versions it supports
+type Matrix struct {
+	KindClusterImages  []KindClusterImage  `json:"kindClusterImages"`
+	KubeadmAPIVersions []KubeadmAPIVersion `json:"kubeadmAPIVersions"`
+}
+
+// KindClusterImage is a tag of the kind-cluster image
+type KindClusterImage struct {
+	Tag            string       `json:"tag"`
+	KindVersion    string       `json:"kindVersion"`
+	KubectlVersion string       `json:"kubectlVersion"`
+	NodeVersions   VersionRange `json:"nodeVersions"`
+	// Features are the features of kink the wrapper of the image supports
+	Features []string `json:"features,omitempty"`
+}
+
+// Supports returns true if the wrapper of the image supports the feature
+func (i *KindClusterImage) Supports(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// KubeadmAPIVersion is the kubeadm API version the node versions in the range accept
+type KubeadmAPIVersion struct {
+	APIVersion   string       `json:"apiVersion"`
+	NodeVersions VersionRange `json:"nodeVersions"`
+}
+
+// VersionRange is an inclusive range of versions, the bounds could be partial versions such as 1.21
+type VersionRange struct {
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+}
+
+// Contains returns true if the version is in the range
+func (r VersionRange) Contains(v string) bool {
+	parsed, err := version.ParseGeneric(v)
+	if err != nil {
+		return false
+	}
+
+	filtered, err := versions.Filter([]*version.Version{parsed}, r.Min, r.Max)
+	return err == nil && len(filtered) == 1
+}
+
+// String returns the human readable form of the range
+func (r VersionRange) String() string {
+	switch {
+	case r.Min != "" && r.Max != "":
+		return fmt.Sprintf("%s - %s", r.Min, r.Max)
+	case r.Min != "":
+		return fmt.Sprintf(">= %s", r.Min)
+	case r.Max != "":
+		return fmt.Sprintf("<= %s", r.Max)
+	}
+	return "any"
+}
+
+// Load reads the matrix from the file, the embedded matrix is used if path is empty
+func Load(path string) (*Matrix, error) {
+	data := defaultMatrix
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Matrix{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing compatibility matrix: %w", err)
+	}
+
+	return m, nil
+}
+
+// Image returns the entry of the kind-cluster image tag
+func (m *Matrix) Image(tag string) (*KindClusterImage, bool) {
+	for i := range m.KindClusterImages {
+		if m.KindClusterImages[i].Tag == tag {
+			return &m.KindClusterImages[i], true
+		}
+	}
+	return nil, false
+}
+
+// FirstImageSupporting returns the tag of the first image whose wrapper supports the feature, or an
+// empty string if there is none
+func (m *Matrix) FirstImageSupporting(feature string) string {
+	for i := range m.KindClusterImages {
+		if m.KindClusterImages[i].Supports(feature) {
+			return m.KindClusterImages[i].Tag
+		}
+	}
+	return ""
+}
+
+// ImageByReference returns the entry of the kind-cluster image by the tag of its reference
+func (m *Matrix) ImageByReference(image string) (*KindClusterImage, bool) {
+	tag := ImageTag(image)
+	if tag == "" {
+		return nil, false
+	}
+	return m.Image(tag)
+}
+
+// ImageTag returns the tag of the image reference, or an empty string if it does not have one
+func ImageTag(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return ""
+	}
+
+	tag, ok := ref.(name.Tag)
+	if !ok {
+		return ""
+	}
+	return tag.TagStr()
+}
+
+// KubeadmAPIVersion returns the kubeadm API version the node version accepts
+func (m *Matrix) KubeadmAPIVersion(nodeVersion string) string {
+	for _, k := range m.KubeadmAPIVersions {
+		if k.NodeVersions.Contains(nodeVersion) {
+			return k.APIVersion
+		}
+	}
+	return DefaultKubeadmAPIVersion
+}
+
+// Compatible returns the tags whose versions are in the range, the other tags are dropped
+func Compatible(tags []string, r VersionRange) []string {
+	var compatible []string
+	for _, t := range tags {
+		if strings.HasPrefix(t, "v") && r.Contains(t) {
+			compatible = append(compatible, t)
+		}
+	}
+	return compatible
+}
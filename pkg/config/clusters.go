@@ -0,0 +1,67 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// ClusterFile lists the clusters created together by "kink run -f"
+type ClusterFile struct {
+	Clusters []ClusterEntry `json:"clusters"`
+}
+
+// ClusterEntry is a cluster of the file, its fields override the flags of "kink run"
+type ClusterEntry struct {
+	Name         string `json:"name"`
+	ClusterName  string `json:"clusterName,omitempty"`
+	WithRegistry *bool  `json:"withRegistry,omitempty"`
+	Profile
+}
+
+// LoadClusterFile reads the cluster file, the names of the clusters should be unique
+func LoadClusterFile(path string) (*ClusterFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ClusterFile{}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("parsing cluster file %s: %w", path, err)
+	}
+
+	if len(f.Clusters) == 0 {
+		return nil, fmt.Errorf("cluster file %s does not list any cluster", path)
+	}
+
+	names := map[string]bool{}
+	for i, c := range f.Clusters {
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster %d in %s does not have a name", i+1, path)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("cluster %s is listed more than once in %s", c.Name, path)
+		}
+		names[c.Name] = true
+	}
+
+	return f, nil
+}
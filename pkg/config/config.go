@@ -0,0 +1,361 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Config is the kink configuration file, it holds the defaults of the flags and
+// named profiles which override them
+type Config struct {
+	CurrentProfile string             `json:"currentProfile,omitempty"`
+	Defaults       Profile            `json:"defaults,omitempty"`
+	Profiles       map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile holds the defaults of the flags
+type Profile struct {
+	Namespace           string                       `json:"namespace,omitempty"`
+	Image               string                       `json:"image,omitempty"`
+	NodeImageRepository string                       `json:"nodeImageRepository,omitempty"`
+	NodeImage           string                       `json:"nodeImage,omitempty"`
+	CompatMatrix        string                       `json:"compatMatrix,omitempty"`
+	ImagePullSecrets    []string                     `json:"imagePullSecrets,omitempty"`
+	ImagePullPolicy     string                       `json:"imagePullPolicy,omitempty"`
+	KubernetesVersion   string                       `json:"kubernetesVersion,omitempty"`
+	Timeout             int                          `json:"timeout,omitempty"`
+	Resources           *corev1.ResourceRequirements `json:"resources,omitempty"`
+	TTL                 string                       `json:"ttl,omitempty"`
+	Expose              string                       `json:"expose,omitempty"`
+	Owner               string                       `json:"owner,omitempty"`
+}
+
+// Keys are the keys which could be set by "kink config set"
+var Keys = []string{
+	"namespace",
+	"image",
+	"nodeImageRepository",
+	"nodeImage",
+	"compatMatrix",
+	"imagePullSecrets",
+	"imagePullPolicy",
+	"kubernetesVersion",
+	"timeout",
+	"resources.requests.cpu",
+	"resources.requests.memory",
+	"resources.limits.cpu",
+	"resources.limits.memory",
+	"ttl",
+	"expose",
+	"owner",
+}
+
+// Path returns the path of the configuration file, KINK_CONFIG takes precedence
+// over ~/.config/kink/config.yaml
+func Path() (string, error) {
+	if p := os.Getenv("KINK_CONFIG"); p != "" {
+		return p, nil
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "kink", "config.yaml"), nil
+}
+
+// Load reads the configuration file, a missing file results in an empty configuration
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Save writes the configuration file
+func (c *Config) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0o600)
+}
+
+// ProfileNames returns the sorted names of the profiles
+func (c *Config) ProfileNames() []string {
+	var names []string
+	for n := range c.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the defaults overridden by the given profile, or by the current profile if name is empty.
+// KINK_PROFILE selects the profile if neither of them is set, and the KINK_IMAGE, KINK_NODE_IMAGE,
+// KINK_IMAGE_PULL_POLICY and KINK_IMAGE_PULL_SECRETS environment variables override the result.
+func (c *Config) Resolve(name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv("KINK_PROFILE")
+	}
+	if name == "" {
+		name = c.CurrentProfile
+	}
+
+	p := c.Defaults
+	if name != "" {
+		override, ok := c.Profiles[name]
+		if !ok {
+			return Profile{}, fmt.Errorf("profile %q is not found in the config file", name)
+		}
+		p = p.merge(override)
+	}
+
+	return p.merge(fromEnv()), nil
+}
+
+// merge returns the profile overridden by the non-empty fields of o
+func (p Profile) merge(o Profile) Profile {
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+
+	setString(&p.Namespace, o.Namespace)
+	setString(&p.Image, o.Image)
+	setString(&p.NodeImageRepository, o.NodeImageRepository)
+	setString(&p.NodeImage, o.NodeImage)
+	setString(&p.CompatMatrix, o.CompatMatrix)
+	setString(&p.ImagePullPolicy, o.ImagePullPolicy)
+	setString(&p.KubernetesVersion, o.KubernetesVersion)
+	setString(&p.TTL, o.TTL)
+	setString(&p.Expose, o.Expose)
+	setString(&p.Owner, o.Owner)
+
+	if len(o.ImagePullSecrets) > 0 {
+		p.ImagePullSecrets = o.ImagePullSecrets
+	}
+	if o.Timeout != 0 {
+		p.Timeout = o.Timeout
+	}
+	if o.Resources != nil {
+		merged := &corev1.ResourceRequirements{}
+		if p.Resources != nil {
+			merged = p.Resources.DeepCopy()
+		}
+		merged.Requests = mergeResources(merged.Requests, o.Resources.Requests)
+		merged.Limits = mergeResources(merged.Limits, o.Resources.Limits)
+		p.Resources = merged
+	}
+
+	return p
+}
+
+func mergeResources(dst, src corev1.ResourceList) corev1.ResourceList {
+	if len(src) == 0 {
+		return dst
+	}
+
+	merged := corev1.ResourceList{}
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		merged[k] = v
+	}
+	return merged
+}
+
+// fromEnv returns the profile set by the environment variables of the images, which predate the config
+// file and override it
+func fromEnv() Profile {
+	p := Profile{
+		Image:           os.Getenv("KINK_IMAGE"),
+		NodeImage:       os.Getenv("KINK_NODE_IMAGE"),
+		ImagePullPolicy: os.Getenv("KINK_IMAGE_PULL_POLICY"),
+	}
+
+	for _, v := range strings.Split(os.Getenv("KINK_IMAGE_PULL_SECRETS"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			p.ImagePullSecrets = append(p.ImagePullSecrets, v)
+		}
+	}
+
+	return p
+}
+
+// Set sets the key of the given profile, or the defaults if profile is empty
+func (c *Config) Set(profile, key, value string) error {
+	p := c.Defaults
+	if profile != "" {
+		p = c.Profiles[profile]
+	}
+
+	switch key {
+	case "namespace":
+		p.Namespace = value
+	case "image":
+		p.Image = value
+	case "nodeImageRepository":
+		p.NodeImageRepository = value
+	case "nodeImage":
+		p.NodeImage = value
+	case "compatMatrix":
+		p.CompatMatrix = value
+	case "imagePullSecrets":
+		p.ImagePullSecrets = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				p.ImagePullSecrets = append(p.ImagePullSecrets, v)
+			}
+		}
+	case "imagePullPolicy":
+		p.ImagePullPolicy = value
+	case "kubernetesVersion":
+		p.KubernetesVersion = value
+	case "timeout":
+		timeout, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", value, err)
+		}
+		p.Timeout = timeout
+	case "resources.requests.cpu", "resources.requests.memory", "resources.limits.cpu", "resources.limits.memory":
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid quantity %q: %w", value, err)
+		}
+		parts := strings.Split(key, ".")
+		if p.Resources == nil {
+			p.Resources = &corev1.ResourceRequirements{}
+		} else {
+			p.Resources = p.Resources.DeepCopy()
+		}
+		list := &p.Resources.Requests
+		if parts[1] == "limits" {
+			list = &p.Resources.Limits
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[corev1.ResourceName(parts[2])] = q
+	case "ttl":
+		p.TTL = value
+	case "expose":
+		p.Expose = value
+	case "owner":
+		p.Owner = value
+	default:
+		return fmt.Errorf("unknown key %q, it should be one of %s", key, strings.Join(Keys, ", "))
+	}
+
+	if profile == "" {
+		c.Defaults = p
+		return nil
+	}
+
+	if c.Profiles == nil {
+		c.Profiles = map[string]Profile{}
+	}
+	c.Profiles[profile] = p
+	return nil
+}
+
+// Flags returns the values of the profile keyed by the names of the flags they are defaults of
+func (p Profile) Flags() map[string][]string {
+	flags := map[string][]string{}
+	add := func(name, value string) {
+		if value != "" {
+			flags[name] = append(flags[name], value)
+		}
+	}
+
+	add("namespace", p.Namespace)
+	add("image", p.Image)
+	add("node-image-repository", p.NodeImageRepository)
+	add("node-image", p.NodeImage)
+	add("compat-matrix", p.CompatMatrix)
+	add("image-pull-policy", p.ImagePullPolicy)
+	add("kubernetes-version", p.KubernetesVersion)
+	add("ttl", p.TTL)
+	add("expose", p.Expose)
+	add("owner", p.Owner)
+	for _, s := range p.ImagePullSecrets {
+		add("image-pull-secret", s)
+	}
+	if p.Timeout != 0 {
+		add("timeout", strconv.Itoa(p.Timeout))
+	}
+	if p.Resources != nil {
+		if cpu, ok := p.Resources.Requests[corev1.ResourceCPU]; ok {
+			add("cpu", cpu.String())
+		}
+		if memory, ok := p.Resources.Requests[corev1.ResourceMemory]; ok {
+			add("memory", memory.String())
+		}
+		if cpu, ok := p.Resources.Limits[corev1.ResourceCPU]; ok {
+			add("cpu-limit", cpu.String())
+		}
+		if memory, ok := p.Resources.Limits[corev1.ResourceMemory]; ok {
+			add("memory-limit", memory.String())
+		}
+	}
+
+	return flags
+}
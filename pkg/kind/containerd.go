@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const criRegistryPlugin = `plugins."io.containerd.grpc.v1.cri".registry`
+
+// ContainerdConfig holds the registry settings of containerd running on KinD nodes
+type ContainerdConfig struct {
+	// Mirrors maps a registry host to the endpoints which should be used to pull its images
+	Mirrors map[string][]string
+	// Insecure holds the registry hosts whose TLS certificates should not be verified
+	Insecure []string
+}
+
+// ParseRegistryMirror parses a mirror given in the form of host=url, a bare url is
+// treated as a mirror of Docker Hub
+func ParseRegistryMirror(s string) (string, string, error) {
+	host, endpoint := DockerHubHost, s
+	if i := strings.Index(s, "="); i >= 0 {
+		host, endpoint = s[:i], s[i+1:]
+	}
+
+	if host == "" || endpoint == "" {
+		return "", "", fmt.Errorf("invalid registry mirror %q, it should be in the form of host=url", s)
+	}
+
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+
+	return host, endpoint, nil
+}
+
+// DockerHubHost is the host containerd uses for the images of Docker Hub
+const DockerHubHost = "docker.io"
+
+// IsDockerHub returns true if the registry host is one of the names of Docker Hub
+func IsDockerHub(host string) bool {
+	switch host {
+	case DockerHubHost, "index.docker.io", "registry-1.docker.io":
+		return true
+	}
+	return false
+}
+
+// AddMirror adds the endpoints to the mirrors of the registry host
+func (c *ContainerdConfig) AddMirror(host string, endpoints ...string) {
+	if c.Mirrors == nil {
+		c.Mirrors = map[string][]string{}
+	}
+	c.Mirrors[host] = append(c.Mirrors[host], endpoints...)
+}
+
+// Patch renders the configuration as a TOML document which is used as one of the
+// containerdConfigPatches of the KinD cluster configuration
+func (c ContainerdConfig) Patch() string {
+	var b strings.Builder
+
+	for _, host := range sortedKeys(c.Mirrors) {
+		var quoted []string
+		for _, e := range c.Mirrors[host] {
+			quoted = append(quoted, fmt.Sprintf("%q", e))
+		}
+		fmt.Fprintf(&b, "[%s.mirrors.%q]\n", criRegistryPlugin, host)
+		fmt.Fprintf(&b, "  endpoint = [%s]\n", strings.Join(quoted, ", "))
+	}
+
+	for _, host := range c.Insecure {
+		fmt.Fprintf(&b, "[%s.configs.%q.tls]\n", criRegistryPlugin, host)
+		b.WriteString("  insecure_skip_verify = true\n")
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import "testing"
+
+func TestParseRegistryMirror(t *testing.T) {
+	tests := []struct {
+		in           string
+		host, target string
+		wantErr      bool
+	}{
+		{in: "mirror.example.com", host: "docker.io", target: "https://mirror.example.com"},
+		{in: "http://mirror.example.com:5000", host: "docker.io", target: "http://mirror.example.com:5000"},
+		{in: "quay.io=https://quay-mirror.example.com", host: "quay.io", target: "https://quay-mirror.example.com"},
+		{in: "gcr.io=gcr-mirror.example.com", host: "gcr.io", target: "https://gcr-mirror.example.com"},
+		{in: "=https://mirror.example.com", wantErr: true},
+		{in: "quay.io=", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		host, target, err := ParseRegistryMirror(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRegistryMirror(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if host != tt.host || target != tt.target {
+			t.Errorf("ParseRegistryMirror(%q) = %q, %q, want %q, %q", tt.in, host, target, tt.host, tt.target)
+		}
+	}
+}
+
+func TestContainerdConfigPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ContainerdConfig
+		want   string
+	}{
+		{name: "empty", config: ContainerdConfig{}, want: ""},
+		{
+			name: "mirrors sorted by host",
+			config: ContainerdConfig{Mirrors: map[string][]string{
+				"quay.io":   {"https://quay-mirror.example.com"},
+				"docker.io": {"https://mirror.example.com", "https://registry-1.docker.io"},
+			}},
+			want: `[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = ["https://mirror.example.com", "https://registry-1.docker.io"]
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."quay.io"]
+  endpoint = ["https://quay-mirror.example.com"]`,
+		},
+		{
+			name: "insecure registries",
+			config: ContainerdConfig{
+				Mirrors:  map[string][]string{"kind-registry:5000": {"http://kind-registry:5000"}},
+				Insecure: []string{"registry.local:5000"},
+			},
+			want: `[plugins."io.containerd.grpc.v1.cri".registry.mirrors."kind-registry:5000"]
+  endpoint = ["http://kind-registry:5000"]
+[plugins."io.containerd.grpc.v1.cri".registry.configs."registry.local:5000".tls]
+  insecure_skip_verify = true`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.config.Patch(); got != tt.want {
+			t.Errorf("%s: Patch() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddMirror(t *testing.T) {
+	var c ContainerdConfig
+	c.AddMirror("docker.io", "https://a.example.com")
+	c.AddMirror("docker.io", "https://b.example.com")
+	if got := c.Mirrors["docker.io"]; len(got) != 2 || got[1] != "https://b.example.com" {
+		t.Errorf("AddMirror() = %v, want the endpoints in the order they are added", got)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kink creates and manages KinD clusters running as Kubernetes pods.
+package kink
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Client manages kink clusters in the outer cluster the REST config points to
+type Client struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+
+	// Logf receives the diagnostic messages, they are discarded if it is nil
+	Logf func(format string, args ...interface{})
+}
+
+// NewClient returns a client for the outer cluster
+func NewClient(config *rest.Config) (*Client, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kubernetes client: %w", err)
+	}
+
+	return &Client{config: config, clientset: clientset}, nil
+}
+
+// Clientset returns the Kubernetes client of the outer cluster
+func (c *Client) Clientset() kubernetes.Interface {
+	return c.clientset
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster is a KinD cluster running in a pod of the outer cluster, it is also the result document of
+// "kink run -o json|yaml"
+type Cluster struct {
+	// Name is the name of the pod and the service of the cluster
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// ClusterName is the name of the KinD cluster inside the pod
+	ClusterName string `json:"clusterName"`
+	Owner       string `json:"owner"`
+
+	Image     string `json:"image"`
+	NodeImage string `json:"nodeImage"`
+	// KubernetesVersion is the version the requested one is resolved to, it is empty if a node image is given
+	KubernetesVersion          string `json:"kubernetesVersion,omitempty"`
+	RequestedKubernetesVersion string `json:"requestedKubernetesVersion,omitempty"`
+
+	Expose ExposeMode `json:"expose,omitempty"`
+	// Endpoint is the address of the API server in the kubeconfig, such as https://10.0.0.1:31234
+	Endpoint string `json:"endpoint,omitempty"`
+	// NodePort is the port of the API server on the nodes of the outer cluster, it is zero for ClusterIP
+	NodePort int32 `json:"nodePort,omitempty"`
+	// Ports are the ports of the KinD control-plane node published on the pod and the Service
+	Ports []int32 `json:"ports,omitempty"`
+	// Registry is the host of the local registry the images are pushed to, it is empty without a registry
+	Registry string `json:"registry,omitempty"`
+	// Kubeconfig is the kubeconfig of the cluster, it is only filled if the cluster is ready
+	Kubeconfig []byte `json:"-"`
+	// KubeconfigPath is the file the kubeconfig is written to, it is only set by the CLI
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"`
+
+	Ready     bool             `json:"ready"`
+	CreatedAt time.Time        `json:"createdAt"`
+	TTL       *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt is nil if the cluster does not have a TTL
+	ExpiresAt *time.Time        `json:"expiresAt,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// RESTConfig returns the REST config of the cluster
+func (c *Cluster) RESTConfig() (*rest.Config, error) {
+	if len(c.Kubeconfig) == 0 {
+		return nil, clusterError("get REST config", c.Namespace, c.Name, ErrNotReady)
+	}
+	return clientcmd.RESTConfigFromKubeConfig(c.Kubeconfig)
+}
+
+// Expired returns true if the TTL of the cluster is expired
+func (c *Cluster) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && now.After(*c.ExpiresAt)
+}
+
+// Get returns the cluster with its kubeconfig. ErrNotReady is returned along with the cluster if it is
+// not ready yet.
+func (c *Client) Get(ctx context.Context, namespace, name string) (*Cluster, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return nil, clusterError("get", namespace, name, err)
+	}
+
+	if _, ok := pod.Labels[types.OwnerLabel]; !ok {
+		return nil, clusterError("get", namespace, name, ErrNotFound)
+	}
+
+	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, clusterError("get", namespace, name, err)
+	}
+	if err != nil {
+		svc = nil
+	}
+
+	cluster := clusterFromPod(pod, svc)
+	if !cluster.Ready || svc == nil {
+		cluster.Ready = false
+		return cluster, clusterError("get", namespace, name, ErrNotReady)
+	}
+
+	if err := c.fetchKubeconfig(ctx, cluster); err != nil {
+		return cluster, clusterError("get", namespace, name, err)
+	}
+
+	return cluster, nil
+}
+
+// List returns the clusters of the owner in the namespace without their kubeconfigs, the clusters of
+// all owners are returned if the owner is empty
+func (c *Client) List(ctx context.Context, namespace, owner string) ([]*Cluster, error) {
+	selector := types.OwnerLabel
+	if owner != "" {
+		selector = OwnerSelector(owner)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make([]*Cluster, 0, len(pods.Items))
+	for i := range pods.Items {
+		clusters = append(clusters, clusterFromPod(&pods.Items[i], nil))
+	}
+
+	return clusters, nil
+}
+
+// Delete deletes the pod, the service and the PVC of the cluster, the grace period is skipped if force
+// is true. Stopped clusters, which do not have a pod, are deleted as well.
+func (c *Client) Delete(ctx context.Context, namespace, name string, force bool) error {
+	options := metav1.DeleteOptions{}
+	if force {
+		gracePeriodSeconds := int64(0)
+		options.GracePeriodSeconds = &gracePeriodSeconds
+	}
+
+	err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, options)
+	if k8serrors.IsNotFound(err) && c.stopped(ctx, namespace, name) {
+		err = nil
+	}
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return clusterError("delete", namespace, name, fmt.Errorf("deleting pod: %w", err))
+	}
+
+	// the service is created once the pod is ready, so it may not exist
+	err = c.clientset.CoreV1().Services(namespace).Delete(ctx, name, options)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return clusterError("delete", namespace, name, fmt.Errorf("deleting service: %w", err))
+	}
+
+	// only the persistent clusters have a PVC, a PVC which is not created by kink is left alone
+	pvcClient := c.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pvc, err := pvcClient.Get(ctx, storageName(name), metav1.GetOptions{})
+	if err == nil && pvc.Labels[types.OwnerLabel] != "" {
+		err = pvcClient.Delete(ctx, pvc.Name, options)
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return clusterError("delete", namespace, name, fmt.Errorf("deleting PVC: %w", err))
+	}
+
+	return nil
+}
+
+// stopped returns true if the cluster is stopped by Stop
+func (c *Client) stopped(ctx context.Context, namespace, name string) bool {
+	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	_, ok := svc.Annotations[types.StoppedPodAnnotation]
+	return ok
+}
+
+// clusterFromPod returns the cluster running in the pod, the service could be nil if it is not known
+func clusterFromPod(pod *corev1.Pod, svc *corev1.Service) *Cluster {
+	cluster := &Cluster{
+		Name:                       pod.Name,
+		Namespace:                  pod.Namespace,
+		Owner:                      pod.Labels[types.OwnerLabel],
+		Image:                      pod.Annotations[types.ImageAnnotation],
+		NodeImage:                  pod.Annotations[types.NodeImageAnnotation],
+		KubernetesVersion:          pod.Annotations[types.KubernetesVersionAnnotation],
+		RequestedKubernetesVersion: pod.Annotations[types.RequestedKubernetesVersionAnnotation],
+		Registry:                   pod.Annotations[types.RegistryAnnotation],
+		Ready:                      isContainersReady(*pod),
+		CreatedAt:                  pod.CreationTimestamp.Time,
+		Labels:                     pod.Labels,
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name != containerName {
+			continue
+		}
+		for _, e := range c.Env {
+			switch e.Name {
+			case "KIND_CLUSTER_NAME":
+				cluster.ClusterName = e.Value
+			case "KIND_EXTRA_PORTS":
+				cluster.Ports = parsePorts(e.Value)
+			}
+		}
+	}
+
+	if ttl, ok := pod.Annotations[types.TTLAnnotation]; ok {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			cluster.TTL = &metav1.Duration{Duration: d}
+		}
+	}
+
+	if expiresAt, ok := pod.Annotations[types.ExpiresAtAnnotation]; ok {
+		if t, err := time.Parse(time.RFC3339, expiresAt); err == nil {
+			cluster.ExpiresAt = &t
+		}
+	}
+
+	if svc != nil {
+		cluster.Expose = ExposeNodePort
+		if svc.Spec.Type == corev1.ServiceTypeClusterIP {
+			cluster.Expose = ExposeClusterIP
+		}
+		cluster.Endpoint = endpoint(pod, svc)
+		if svc.Spec.Type == corev1.ServiceTypeNodePort {
+			cluster.NodePort = svc.Spec.Ports[0].NodePort
+		}
+	}
+
+	return cluster
+}
+
+// parsePorts parses the space separated ports of KIND_EXTRA_PORTS
+func parsePorts(s string) []int32 {
+	var ports []int32
+	for _, f := range strings.Fields(s) {
+		p, err := strconv.ParseInt(f, 10, 32)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, int32(p))
+	}
+	return ports
+}
+
+// endpoint returns the address of the API server for the way it is exposed
+func endpoint(pod *corev1.Pod, svc *corev1.Service) string {
+	if svc.Spec.Type == corev1.ServiceTypeClusterIP {
+		return fmt.Sprintf("https://%s:%d", serviceHostnames(pod.Name, pod.Namespace)[2], apiServerPort)
+	}
+	return fmt.Sprintf("https://%s:%d", pod.Status.HostIP, svc.Spec.Ports[0].NodePort)
+}
+
+// fetchKubeconfig reads the kubeconfig of the cluster and points it to the endpoint of the cluster
+func (c *Client) fetchKubeconfig(ctx context.Context, cluster *Cluster) error {
+	kubeconfig, err := c.Exec(ctx, cluster.Namespace, cluster.Name, []string{"kubectl", "config", "view", "--minify", "--flatten"})
+	if err != nil {
+		return fmt.Errorf("reading kubeconfig: %w", err)
+	}
+
+	podIP, err := c.Exec(ctx, cluster.Namespace, cluster.Name, []string{"sh", "-c", "echo $API_SERVER_ADDRESS"})
+	if err != nil {
+		return fmt.Errorf("reading API server address: %w", err)
+	}
+
+	server := fmt.Sprintf("https://%s:%d", podIP, apiServerPort)
+	cluster.Kubeconfig = []byte(strings.ReplaceAll(kubeconfig, server, cluster.Endpoint))
+	return nil
+}
+
+// cluster returns the cluster without its kubeconfig whether it is ready or not
+func (c *Client) cluster(ctx context.Context, namespace, name string) (*Cluster, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+
+	return clusterFromPod(pod, nil), nil
+}
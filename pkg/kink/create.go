@@ -0,0 +1,668 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/compat"
+	"github.com/Trendyol/kink/pkg/kind"
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	"github.com/Trendyol/kink/pkg/versions"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// apiServerPort is the port the API server of the KinD cluster listens on inside the pod
+const apiServerPort = 30001
+
+// rollbackTimeout is how long to try deleting the objects of a cluster which is failed to be created
+const rollbackTimeout = 30 * time.Second
+
+// Create creates the pod running the KinD cluster and the service in front of its API server, and
+// waits until the cluster is ready. The objects created so far are deleted if it fails or the context
+// is cancelled, the returned ClusterError reports the rollback.
+func (c *Client) Create(ctx context.Context, spec Spec) (*Cluster, error) {
+	spec, err := spec.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	// the Service of a stopped cluster records its pod, it should not be adopted by a new cluster
+	if c.stopped(ctx, spec.Namespace, spec.Name) {
+		return nil, clusterError("create", spec.Namespace, spec.Name, ErrStopped)
+	}
+
+	if spec.Snapshot != nil {
+		info, err := c.snapshotInfo(ctx, spec.Namespace, spec.Snapshot)
+		if err != nil {
+			return nil, clusterError("create", spec.Namespace, spec.Name, err)
+		}
+		if spec.ClusterName != "" && spec.ClusterName != info.ClusterName {
+			return nil, clusterError("create", spec.Namespace, spec.Name,
+				fmt.Errorf("%w: cluster name of the snapshot is %s", ErrInvalidSpec, info.ClusterName))
+		}
+		spec.ClusterName = info.ClusterName
+		spec.NodeImage = info.NodeImage
+	}
+
+	podObj, err := c.podFor(ctx, spec)
+	if err != nil {
+		return nil, clusterError("create", spec.Namespace, spec.Name, err)
+	}
+
+	// created holds the objects made by this call, only they are deleted by the rollback
+	var created []string
+	rollback := func(err error) error {
+		objects := make([]string, 0, len(created))
+		for i := len(created) - 1; i >= 0; i-- {
+			objects = append(objects, created[i])
+		}
+		c.logf("rolling back the operation: %v\n", err)
+		return &ClusterError{
+			Op:        "create",
+			Namespace: spec.Namespace,
+			Name:      spec.Name,
+			Err:       err,
+			Rollback:  c.rollback(spec.Namespace, spec.Name, objects),
+		}
+	}
+
+	if spec.Persistent {
+		if err := c.createStorage(ctx, spec, podObj.Labels); err != nil {
+			return nil, clusterError("create", spec.Namespace, spec.Name, err)
+		}
+		created = append(created, "PersistentVolumeClaim")
+	}
+
+	podClient := c.clientset.CoreV1().Pods(spec.Namespace)
+	_, err = podClient.Create(ctx, podObj, metav1.CreateOptions{})
+	// the pod may have been created even if the request failed, unless it already existed
+	if err == nil || !k8serrors.IsAlreadyExists(err) {
+		created = append(created, "Pod")
+	}
+	if err != nil {
+		if len(created) == 0 {
+			return nil, clusterError("create", spec.Namespace, spec.Name, err)
+		}
+		return nil, rollback(err)
+	}
+
+	if spec.Snapshot != nil && spec.Snapshot.File != "" {
+		if err := c.uploadSnapshot(ctx, spec); err != nil {
+			return nil, rollback(err)
+		}
+	}
+
+	deadline := time.Now().Add(spec.Timeout)
+	pod, err := c.waitForPod(ctx, spec)
+	if err != nil {
+		return nil, rollback(fmt.Errorf("waiting for the pod to be ready: %w", err))
+	}
+
+	svc, svcCreated, err := c.applyService(ctx, spec, podObj.Labels)
+	if svcCreated {
+		created = append(created, "Service")
+	}
+	if err != nil {
+		return nil, rollback(err)
+	}
+
+	cluster := clusterFromPod(pod, svc)
+	if err := c.fetchKubeconfig(ctx, cluster); err != nil {
+		return nil, rollback(err)
+	}
+
+	if err := c.waitForInner(ctx, spec, cluster, deadline); err != nil {
+		return nil, rollback(fmt.Errorf("waiting for the KinD cluster to be ready: %w", err))
+	}
+
+	return cluster, nil
+}
+
+// rollback deletes the objects of the cluster which is failed to be created, the context of the
+// operation is not used since it may have been cancelled
+func (c *Client) rollback(namespace, name string, objects []string) *Rollback {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	r := &Rollback{}
+	for _, kind := range objects {
+		var err error
+		objectName := name
+		switch kind {
+		case "Pod":
+			err = c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		case "Service":
+			err = c.clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		case "PersistentVolumeClaim":
+			objectName = storageName(name)
+			err = c.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, objectName, metav1.DeleteOptions{})
+		}
+
+		object := fmt.Sprintf("%s %s/%s", kind, namespace, objectName)
+		switch {
+		case err == nil:
+			c.logf("deleted %s\n", object)
+			r.Deleted = append(r.Deleted, object)
+		case k8serrors.IsNotFound(err):
+		default:
+			c.logf("could not delete %s: %v\n", object, err)
+			r.Failed = append(r.Failed, fmt.Errorf("deleting %s: %w", object, err))
+		}
+	}
+
+	return r
+}
+
+// podFor returns the pod running the KinD cluster of the spec
+func (c *Client) podFor(ctx context.Context, spec Spec) (*corev1.Pod, error) {
+	imageEntry, ok := spec.CompatMatrix.ImageByReference(spec.Image)
+	if !ok {
+		c.logf("image %s is not in the compatibility matrix, node versions will not be checked\n", spec.Image)
+	}
+	if imageEntry != nil {
+		if err := checkFeatures(spec, imageEntry); err != nil {
+			return nil, err
+		}
+	}
+
+	nodeImage := spec.NodeImage
+	var resolvedVersion string
+	if nodeImage == "" {
+		var err error
+		resolvedVersion, err = c.resolveKubernetesVersion(ctx, spec.NodeImageRepository, spec.KubernetesVersion, imageEntry)
+		if err != nil {
+			return nil, err
+		}
+		nodeImage = spec.NodeImageRepository + ":" + resolvedVersion
+	}
+
+	for _, ref := range []string{spec.Image, nodeImage} {
+		if _, err := name.ParseReference(ref); err != nil {
+			return nil, fmt.Errorf("%w: image reference %q: %v", ErrInvalidSpec, ref, err)
+		}
+	}
+
+	nodeVersion := resolvedVersion
+	if nodeVersion == "" {
+		nodeVersion = compat.ImageTag(nodeImage)
+	}
+	if imageEntry != nil && versions.IsConcrete(nodeVersion) && !imageEntry.NodeVersions.Contains(nodeVersion) {
+		return nil, fmt.Errorf("%w: node image %s is not supported by %s which bundles KinD %s, supported versions: %s",
+			ErrUnsupportedVersion, nodeImage, spec.Image, imageEntry.KindVersion, imageEntry.NodeVersions)
+	}
+
+	kubeadmAPIVersion := compat.DefaultKubeadmAPIVersion
+	if versions.IsConcrete(nodeVersion) {
+		kubeadmAPIVersion = spec.CompatMatrix.KubeadmAPIVersion(nodeVersion)
+	}
+
+	generatedUUID := uuid.NewUUID()
+
+	clusterName := spec.ClusterName
+	if clusterName == "" {
+		clusterName = "kind-" + string(generatedUUID)
+	}
+
+	labels := map[string]string{}
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	labels[types.OwnerLabel] = spec.Owner
+	labels[types.UUIDLabel] = string(generatedUUID)
+	podObj := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        spec.Name,
+			Namespace:   spec.Namespace,
+			Annotations: kubernetes.ManagedAnnotations(),
+			Labels:      labels,
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: storageVolume,
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
+					},
+				},
+				{
+					Name: "libmodules",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Path: "/lib/modules",
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  containerName,
+					Image: spec.Image,
+					Args: []string{
+						"/bin/bash",
+					},
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "api-server-port",
+							HostPort:      0,
+							ContainerPort: apiServerPort,
+							Protocol:      corev1.Protocol("TCP"),
+						},
+					},
+					Env: []corev1.EnvVar{
+						{
+							Name: "API_SERVER_ADDRESS",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{
+									FieldPath: "status.podIP",
+								},
+							},
+						},
+						{
+							Name: "CERT_SANS",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{
+									FieldPath: "status.hostIP",
+								},
+							},
+						},
+						{
+							Name:  "EXTRA_CERT_SANS",
+							Value: strings.Join(serviceHostnames(spec.Name, spec.Namespace), " "),
+						},
+						{
+							Name:  "KIND_CLUSTER_NAME",
+							Value: clusterName,
+						},
+						{
+							Name:  "KIND_NODE_IMAGE",
+							Value: nodeImage,
+						},
+						{
+							Name:  "KUBEADM_API_VERSION",
+							Value: kubeadmAPIVersion,
+						},
+					},
+					Resources: spec.Resources,
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      storageVolume,
+							MountPath: "/var/lib/docker",
+						},
+						{
+							Name:      "libmodules",
+							ReadOnly:  true,
+							MountPath: "/lib/modules",
+						},
+					},
+					ReadinessProbe: &corev1.Probe{
+						Handler: corev1.Handler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: "/healthz",
+								Port: intstr.IntOrString{
+									Type:   intstr.Type(1),
+									IntVal: 0,
+									StrVal: "api-server-port",
+								},
+								Scheme: corev1.URIScheme("HTTPS"),
+							},
+						},
+						InitialDelaySeconds: 120,
+						TimeoutSeconds:      1,
+						PeriodSeconds:       20,
+						SuccessThreshold:    1,
+						FailureThreshold:    15,
+					},
+					ImagePullPolicy: spec.ImagePullPolicy,
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: ptrbool(true),
+					},
+					Stdin: true,
+					TTY:   true,
+				},
+			},
+		},
+	}
+
+	if spec.TTL > 0 {
+		podObj.Annotations[types.TTLAnnotation] = spec.TTL.String()
+		podObj.Annotations[types.ExpiresAtAnnotation] = time.Now().Add(spec.TTL).UTC().Format(time.RFC3339)
+	}
+
+	if resolvedVersion != "" {
+		podObj.Annotations[types.RequestedKubernetesVersionAnnotation] = spec.KubernetesVersion
+		podObj.Annotations[types.KubernetesVersionAnnotation] = resolvedVersion
+	}
+
+	podObj.Annotations[types.ImageAnnotation] = spec.Image
+	podObj.Annotations[types.NodeImageAnnotation] = nodeImage
+	for _, secret := range spec.ImagePullSecrets {
+		podObj.Spec.ImagePullSecrets = append(podObj.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+
+	containerd := kind.ContainerdConfig{Insecure: spec.InsecureRegistries}
+	var dockerArgs []string
+	for _, m := range spec.RegistryMirrors {
+		host, endpoint, err := kind.ParseRegistryMirror(m)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+		}
+		containerd.AddMirror(host, endpoint)
+
+		// dockerd only supports mirroring Docker Hub
+		if kind.IsDockerHub(host) {
+			dockerArgs = append(dockerArgs, "--registry-mirror="+endpoint)
+		} else {
+			c.logf("the Docker daemon of the pod does not support mirroring %s, it is configured only for the KinD nodes\n", host)
+		}
+	}
+	for _, r := range spec.InsecureRegistries {
+		dockerArgs = append(dockerArgs, "--insecure-registry="+r)
+	}
+
+	if spec.WithRegistry {
+		enableRegistry(podObj, &containerd)
+	}
+
+	if spec.Snapshot != nil {
+		addSnapshotVolume(podObj, spec.Snapshot)
+	}
+
+	if spec.Persistent {
+		for i := range podObj.Spec.Volumes {
+			if podObj.Spec.Volumes[i].Name == storageVolume {
+				podObj.Spec.Volumes[i].VolumeSource = corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: storageName(spec.Name)},
+				}
+			}
+		}
+	}
+
+	if len(spec.Ports) > 0 {
+		publishPorts(podObj, spec.Ports)
+	}
+
+	if len(dockerArgs) > 0 {
+		podObj.Spec.Containers[0].Env = append(podObj.Spec.Containers[0].Env,
+			corev1.EnvVar{Name: "DOCKER_ARGS", Value: strings.Join(dockerArgs, " ")})
+	}
+
+	if patch := containerd.Patch(); patch != "" {
+		podObj.Spec.Containers[0].Env = append(podObj.Spec.Containers[0].Env,
+			corev1.EnvVar{Name: "KIND_CONTAINERD_CONFIG_PATCH", Value: patch})
+	}
+
+	return podObj, nil
+}
+
+// waitForPod waits until the pod is ready
+func (c *Client) waitForPod(ctx context.Context, spec Spec) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	err := wait.PollImmediateUntil(time.Second, func() (done bool, err error) {
+		if spec.Progress != nil {
+			spec.Progress()
+		}
+
+		pod, err = c.clientset.CoreV1().Pods(spec.Namespace).Get(ctx, spec.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, ErrPodFailed
+		}
+
+		return isContainersReady(*pod), nil
+	}, timeoutDone(ctx, spec.Timeout))
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrTimeout
+	}
+
+	return pod, err
+}
+
+// timeoutDone returns a channel which is closed when the context is done or the timeout passes
+func timeoutDone(ctx context.Context, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+		case <-time.After(timeout):
+		}
+	}()
+	return done
+}
+
+// applyService creates the service in front of the API server, or updates it if it already exists.
+// created is true if the service is created by this call, or may have been created by a failed request.
+func (c *Client) applyService(ctx context.Context, spec Spec, labels map[string]string) (svc *corev1.Service, created bool, err error) {
+	serviceType, err := spec.Expose.serviceType()
+	if err != nil {
+		return nil, false, err
+	}
+
+	serviceClient := c.clientset.CoreV1().Services(spec.Namespace)
+
+	// Create resource object
+	serviceObj := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: spec.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name: "api-server",
+					Port: apiServerPort,
+					TargetPort: intstr.IntOrString{
+						Type:   intstr.Type(0),
+						IntVal: apiServerPort,
+					},
+				},
+			},
+			Selector: serviceSelector(labels),
+			Type:     serviceType,
+		},
+	}
+
+	for _, p := range spec.Ports {
+		serviceObj.Spec.Ports = append(serviceObj.Spec.Ports, corev1.ServicePort{
+			Name:       fmt.Sprintf("port-%d", p),
+			Port:       p,
+			TargetPort: intstr.FromInt(int(p)),
+		})
+	}
+
+	// Manage resource
+	svc, err = serviceClient.Create(ctx, serviceObj, metav1.CreateOptions{})
+	if err == nil {
+		return svc, true, nil
+	}
+
+	// if target service already exist, we do not need to create it again
+	if !k8serrors.IsAlreadyExists(err) {
+		return nil, true, fmt.Errorf("could not create service: %w", err)
+	}
+
+	svcGet, err := serviceClient.Get(ctx, spec.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("could not get service: %w", err)
+	}
+
+	toUpdate := serviceObj.DeepCopy()
+	toUpdate.ObjectMeta = svcGet.ObjectMeta
+	toUpdate.Spec.ClusterIP = svcGet.Spec.ClusterIP
+	toUpdate.Spec.ClusterIPs = svcGet.Spec.ClusterIPs
+
+	svc, err = serviceClient.Update(ctx, toUpdate, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("could not update service: %w", err)
+	}
+
+	return svc, false, nil
+}
+
+// resolveKubernetesVersion resolves the requested version, which could also be an alias or a partial
+// version, against the node image tags supported by the kind-cluster image. The cached tags are used
+// when the registry could not be reached.
+func (c *Client) resolveKubernetesVersion(ctx context.Context, repository, k8sVersion string, imageEntry *compat.KindClusterImage) (string, error) {
+	if imageEntry != nil && versions.IsConcrete(k8sVersion) && !imageEntry.NodeVersions.Contains(k8sVersion) {
+		return "", fmt.Errorf("%w: %s is not supported by kind-cluster image %s which bundles KinD %s, supported versions: %s",
+			ErrUnsupportedVersion, k8sVersion, imageEntry.Tag, imageEntry.KindVersion, imageEntry.NodeVersions)
+	}
+
+	tags, fromCache, err := versions.Tags(ctx, repository)
+	if err != nil {
+		if !versions.IsConcrete(k8sVersion) {
+			return "", fmt.Errorf("could not resolve Kubernetes version %s: %w", k8sVersion, err)
+		}
+		c.logf("could not validate Kubernetes version %s: %v\n", k8sVersion, err)
+		return "v" + strings.TrimPrefix(k8sVersion, "v"), nil
+	}
+	if fromCache {
+		c.logf("%s could not be reached, resolving Kubernetes version against the cached versions\n", repository)
+	}
+
+	if imageEntry != nil {
+		tags = compat.Compatible(tags, imageEntry.NodeVersions)
+	}
+
+	resolved, err := versions.Resolve(tags, k8sVersion)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s, run \"kink list-supported-versions\" to see the supported ones: %v", ErrUnsupportedVersion, k8sVersion, err)
+	}
+
+	if resolved != "v"+strings.TrimPrefix(k8sVersion, "v") {
+		c.logf("Kubernetes version %s is resolved to %s\n", k8sVersion, resolved)
+	}
+
+	return resolved, nil
+}
+
+// enableRegistry configures the pod to run a local registry next to the KinD cluster, the nodes pull
+// images named "localhost:<RegistryPort>/..." from it
+func enableRegistry(pod *corev1.Pod, containerd *kind.ContainerdConfig) {
+	registryHost := fmt.Sprintf("localhost:%d", types.RegistryPort)
+	containerd.AddMirror(registryHost, "http://kind-registry:5000")
+
+	c := &pod.Spec.Containers[0]
+	c.Env = append(c.Env,
+		corev1.EnvVar{Name: "KIND_REGISTRY_ENABLED", Value: "true"},
+		corev1.EnvVar{Name: "KIND_REGISTRY_NAME", Value: "kind-registry"},
+		corev1.EnvVar{Name: "KIND_REGISTRY_PORT", Value: fmt.Sprint(types.RegistryPort)},
+	)
+	c.Ports = append(c.Ports, corev1.ContainerPort{
+		Name:          "registry",
+		ContainerPort: types.RegistryPort,
+		Protocol:      corev1.Protocol("TCP"),
+	})
+
+	pod.Annotations[types.RegistryAnnotation] = registryHost
+}
+
+// checkFeatures returns an error if the spec needs a feature the wrapper of the image does not support
+func checkFeatures(spec Spec, image *compat.KindClusterImage) error {
+	var needed []string
+	if spec.Snapshot != nil {
+		needed = append(needed, compat.FeatureSnapshot)
+	}
+	if spec.Persistent {
+		needed = append(needed, compat.FeaturePersistent)
+	}
+	if len(spec.Ports) > 0 {
+		needed = append(needed, compat.FeaturePorts)
+	}
+
+	for _, f := range needed {
+		if !image.Supports(f) {
+			return fmt.Errorf("%w: %s does not support %s, use the kind-cluster image %s or later",
+				ErrInvalidSpec, spec.Image, f, spec.CompatMatrix.FirstImageSupporting(f))
+		}
+	}
+	return nil
+}
+
+// serviceSelector returns the selector of the Service in front of the pod, it only selects on the UUID
+// since the other labels could change, such as when a cluster of a pool is claimed
+func serviceSelector(podLabels map[string]string) map[string]string {
+	return map[string]string{types.UUIDLabel: podLabels[types.UUIDLabel]}
+}
+
+// publishPorts configures the pod to publish the ports of the KinD control-plane node on its own ports
+func publishPorts(pod *corev1.Pod, ports []int32) {
+	c := &pod.Spec.Containers[0]
+	var env []string
+	for _, p := range ports {
+		env = append(env, fmt.Sprint(p))
+		c.Ports = append(c.Ports, corev1.ContainerPort{
+			Name:          fmt.Sprintf("port-%d", p),
+			ContainerPort: p,
+			Protocol:      corev1.Protocol("TCP"),
+		})
+	}
+	c.Env = append(c.Env, corev1.EnvVar{Name: "KIND_EXTRA_PORTS", Value: strings.Join(env, " ")})
+}
+
+// serviceHostnames returns the names of the Service in front of the API server, they are added to the
+// certificate of the API server so that it could be reached from the same cluster
+func serviceHostnames(name, namespace string) []string {
+	return []string{
+		name,
+		fmt.Sprintf("%s.%s", name, namespace),
+		fmt.Sprintf("%s.%s.svc", name, namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", name, namespace),
+	}
+}
+
+func isContainersReady(pod corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+func ptrbool(p bool) *bool {
+	return &p
+}
@@ -0,0 +1,459 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/types"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// CheckStatus is the outcome of a preflight check
+type CheckStatus string
+
+const (
+	// CheckOK is reported for the prerequisites which are met
+	CheckOK CheckStatus = "ok"
+	// CheckWarning is reported for the prerequisites which may make some clusters fail
+	CheckWarning CheckStatus = "warning"
+	// CheckFailed is reported for the prerequisites which are not met, the clusters could not be run
+	CheckFailed CheckStatus = "failed"
+	// CheckSkipped is reported for the checks which depend on a failed one
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// CheckResult is the result of a preflight check of "kink doctor"
+type CheckResult struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// DoctorOptions configures the pods the preflight checks run, they should match the clusters to create
+type DoctorOptions struct {
+	Image            string
+	ImagePullSecrets []string
+	ImagePullPolicy  corev1.PullPolicy
+	// Timeout is how long to wait for the probe pod to run
+	Timeout time.Duration
+}
+
+// doctorLabel selects the probe pod for the Service checking the NodePort reachability
+const doctorLabel = "kink.trendyol.com/doctor"
+
+// probePort is the port the probe pod answers on
+const probePort = 8080
+
+// probeScript reports the node the probe pod runs on and answers on probePort, perl is part of every
+// Debian image
+var probeScript = fmt.Sprintf(`echo "cgroup=$(stat -fc %%T /sys/fs/cgroup)"
+echo "kernel=$(uname -r)"
+if [ -d "/host/lib/modules/$(uname -r)" ]; then echo "modules=true"; else echo "modules=false"; fi
+exec perl -MIO::Socket::INET -e '$s = IO::Socket::INET->new(LocalPort => %d, Listen => 5, ReuseAddr => 1) or die;
+while ($c = $s->accept) { print $c "kink\n"; close $c }'`, probePort)
+
+// rbacChecks are the permissions kink needs in the namespace by resource, the ones which only some
+// features need are warned about with them
+var rbacChecks = []struct {
+	resource, subresource string
+	verbs                 []string
+	neededBy              string
+}{
+	{"pods", "", []string{"create", "get", "list", "delete"}, ""},
+	{"pods", "exec", []string{"create"}, ""},
+	{"pods", "portforward", []string{"create"}, ""},
+	{"pods", "log", []string{"get"}, ""},
+	{"services", "", []string{"create", "get", "update", "delete"}, ""},
+	{"persistentvolumeclaims", "", []string{"create", "get", "update", "delete"}, "--persistent and snapshots"},
+	{"configmaps", "", []string{"create", "get", "list", "update", "delete"}, "pools"},
+}
+
+// Doctor checks in advance whether clusters could be created in the namespace: the RBAC permissions,
+// the privileged pods, the image pull, /lib/modules and the cgroup version of the nodes, and the
+// reachability of a NodePort from the client. A probe pod and a Service are created and deleted for
+// the checks of the nodes.
+func (c *Client) Doctor(ctx context.Context, namespace string, opts DoctorOptions) ([]CheckResult, error) {
+	if opts.Image == "" {
+		opts.Image = types.ImageRepository + ":" + types.ImageTag
+	}
+	if opts.ImagePullPolicy == "" {
+		opts.ImagePullPolicy = corev1.PullIfNotPresent
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+
+	var results []CheckResult
+	allowed := true
+	for _, rc := range rbacChecks {
+		r, err := c.checkAccess(ctx, namespace, rc.resource, rc.subresource, rc.verbs)
+		if err != nil {
+			return results, err
+		}
+		if r.Status == CheckFailed && rc.neededBy != "" {
+			r.Status = CheckWarning
+			r.Message += ", needed by " + rc.neededBy
+		}
+		allowed = allowed && r.Status != CheckFailed
+		results = append(results, r)
+	}
+
+	results = append(results, c.checkPrivileged(ctx, namespace, opts))
+
+	if !allowed {
+		for _, name := range []string{"image pull", "/lib/modules", "cgroup version", "NodePort"} {
+			results = append(results, CheckResult{Name: name, Status: CheckSkipped, Message: "the RBAC permissions are missing"})
+		}
+		return results, nil
+	}
+
+	return append(results, c.checkNodes(ctx, namespace, opts)...), nil
+}
+
+// checkAccess checks the verbs on the resource with SelfSubjectAccessReviews
+func (c *Client) checkAccess(ctx context.Context, namespace, resource, subresource string, verbs []string) (CheckResult, error) {
+	name := "RBAC " + resource
+	if subresource != "" {
+		name += "/" + subresource
+	}
+
+	var denied []string
+	for _, verb := range verbs {
+		review, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        verb,
+					Resource:    resource,
+					Subresource: subresource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return CheckResult{}, fmt.Errorf("reviewing access to %s: %w", name, err)
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, verb)
+		}
+	}
+
+	if len(denied) > 0 {
+		return CheckResult{Name: name, Status: CheckFailed, Message: "denied: " + strings.Join(denied, ", ")}, nil
+	}
+	return CheckResult{Name: name, Status: CheckOK, Message: "allowed: " + strings.Join(verbs, ", ")}, nil
+}
+
+// checkPrivileged checks the Pod Security Admission labels of the namespace, and creates the pod of a
+// cluster with a server-side dry-run so that the other admission controllers are also checked
+func (c *Client) checkPrivileged(ctx context.Context, namespace string, opts DoctorOptions) CheckResult {
+	result := CheckResult{Name: "privileged pods"}
+
+	ns, err := c.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil {
+		if level := ns.Labels["pod-security.kubernetes.io/enforce"]; level != "" && level != "privileged" {
+			result.Status = CheckFailed
+			result.Message = fmt.Sprintf("namespace enforces the %s Pod Security Standard, kink needs privileged", level)
+			return result
+		}
+	}
+
+	spec, err := Spec{
+		Name:             "kink-doctor-" + rand.String(5),
+		Namespace:        namespace,
+		Image:            opts.Image,
+		NodeImage:        types.NodeImageRepository + ":v" + types.NodeImageTag,
+		ImagePullSecrets: opts.ImagePullSecrets,
+		ImagePullPolicy:  opts.ImagePullPolicy,
+	}.withDefaults()
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = err.Error()
+		return result
+	}
+
+	pod, err := c.podFor(ctx, spec)
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = err.Error()
+		return result
+	}
+
+	_, err = c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("the pod of a cluster is rejected: %v", err)
+		return result
+	}
+
+	result.Status = CheckOK
+	result.Message = "the pod of a cluster is admitted by a dry-run"
+	return result
+}
+
+// checkNodes runs the probe pod to check the image pull, /lib/modules and the cgroup version of its
+// node, and the reachability of a NodePort in front of it
+func (c *Client) checkNodes(ctx context.Context, namespace string, opts DoctorOptions) []CheckResult {
+	name := "kink-doctor-" + rand.String(5)
+	labels := map[string]string{doctorLabel: name}
+	skipped := func(status CheckStatus, msg string) []CheckResult {
+		return []CheckResult{
+			{Name: "image pull", Status: status, Message: msg},
+			{Name: "/lib/modules", Status: CheckSkipped, Message: "the probe pod could not run"},
+			{Name: "cgroup version", Status: CheckSkipped, Message: "the probe pod could not run"},
+			{Name: "NodePort", Status: CheckSkipped, Message: "the probe pod could not run"},
+		}
+	}
+
+	pod := probePod(name, namespace, labels, opts)
+	if _, err := c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return skipped(CheckSkipped, fmt.Sprintf("the probe pod could not be created: %v", err))
+	}
+	defer c.deleteProbe(namespace, name)
+
+	pod, err := c.waitForProbe(ctx, namespace, name, opts.Timeout)
+	if err != nil {
+		return skipped(CheckFailed, err.Error())
+	}
+
+	results := []CheckResult{{Name: "image pull", Status: CheckOK, Message: fmt.Sprintf("%s is pulled on node %s", opts.Image, pod.Spec.NodeName)}}
+
+	report, err := c.probeReport(ctx, namespace, name)
+	if err != nil {
+		results = append(results,
+			CheckResult{Name: "/lib/modules", Status: CheckFailed, Message: err.Error()},
+			CheckResult{Name: "cgroup version", Status: CheckFailed, Message: err.Error()})
+	} else {
+		results = append(results, modulesResult(report, pod.Spec.NodeName), cgroupResult(report, pod.Spec.NodeName))
+	}
+
+	return append(results, c.checkNodePort(ctx, namespace, name, labels, pod))
+}
+
+// probePod returns the pod reporting its node and answering on probePort
+func probePod(name, namespace string, labels map[string]string, opts DoctorOptions) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:            "probe",
+					Image:           opts.Image,
+					ImagePullPolicy: opts.ImagePullPolicy,
+					Command:         []string{"/bin/bash", "-c", probeScript},
+					Ports:           []corev1.ContainerPort{{ContainerPort: probePort, Protocol: corev1.ProtocolTCP}},
+					VolumeMounts:    []corev1.VolumeMount{{Name: "libmodules", MountPath: "/host/lib/modules", ReadOnly: true}},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "libmodules",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/lib/modules"},
+					},
+				},
+			},
+		},
+	}
+	for _, secret := range opts.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+	return pod
+}
+
+// deleteProbe deletes the probe pod and its Service once the checks are done, only the failures are
+// logged since they are not part of any cluster
+func (c *Client) deleteProbe(namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	gracePeriodSeconds := int64(0)
+	options := metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}
+	if err := c.clientset.CoreV1().Services(namespace).Delete(ctx, name, options); err != nil && !k8serrors.IsNotFound(err) {
+		c.logf("could not delete probe Service %s/%s: %v\n", namespace, name, err)
+	}
+	if err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, options); err != nil && !k8serrors.IsNotFound(err) {
+		c.logf("could not delete probe pod %s/%s: %v\n", namespace, name, err)
+	}
+}
+
+// waitForProbe waits until the probe pod is running, the image pull errors are returned right away
+func (c *Client) waitForProbe(ctx context.Context, namespace, name string, timeout time.Duration) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	var pending string
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		var err error
+		pod, err = c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("the probe pod terminated: %s", pod.Status.Message)
+		}
+
+		pending = "the probe pod is " + strings.ToLower(string(pod.Status.Phase))
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting == nil {
+				continue
+			}
+			switch cs.State.Waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
+				return false, fmt.Errorf("%s: %s", cs.State.Waiting.Reason, cs.State.Waiting.Message)
+			}
+			pending = fmt.Sprintf("the probe pod is waiting: %s", cs.State.Waiting.Reason)
+		}
+		return false, nil
+	}, timeoutDone(ctx, timeout))
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("timed out, %s", pending)
+	}
+	return pod, err
+}
+
+// probeReport returns the key=value lines the probe pod logs before answering
+func (c *Client) probeReport(ctx context.Context, namespace, name string) (map[string]string, error) {
+	report := map[string]string{}
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		logs, err := c.clientset.CoreV1().Pods(namespace).GetLogs(name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(logs)))
+		for scanner.Scan() {
+			if kv := strings.SplitN(scanner.Text(), "=", 2); len(kv) == 2 {
+				report[kv[0]] = kv[1]
+			}
+		}
+		_, done := report["modules"]
+		return done, nil
+	}, timeoutDone(ctx, 30*time.Second))
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return nil, errors.New("the probe pod did not report its node")
+	}
+	return report, err
+}
+
+func modulesResult(report map[string]string, node string) CheckResult {
+	result := CheckResult{Name: "/lib/modules"}
+	if report["modules"] == "true" {
+		result.Status = CheckOK
+		result.Message = fmt.Sprintf("node %s has the modules of kernel %s", node, report["kernel"])
+	} else {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("node %s does not have /lib/modules/%s, KinD could not load the kernel modules", node, report["kernel"])
+	}
+	return result
+}
+
+func cgroupResult(report map[string]string, node string) CheckResult {
+	result := CheckResult{Name: "cgroup version"}
+	switch report["cgroup"] {
+	case "cgroup2fs":
+		result.Status = CheckOK
+		result.Message = fmt.Sprintf("node %s runs cgroup v2", node)
+	case "tmpfs":
+		result.Status = CheckOK
+		result.Message = fmt.Sprintf("node %s runs cgroup v1", node)
+	default:
+		result.Status = CheckWarning
+		result.Message = fmt.Sprintf("node %s runs an unknown cgroup file system %q", node, report["cgroup"])
+	}
+	return result
+}
+
+// checkNodePort exposes the probe pod on a NodePort and connects to it the way kink connects to the
+// API server of a cluster
+func (c *Client) checkNodePort(ctx context.Context, namespace, name string, labels map[string]string, pod *corev1.Pod) CheckResult {
+	result := CheckResult{Name: "NodePort"}
+
+	svc, err := c.clientset.CoreV1().Services(namespace).Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeNodePort,
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Port: probePort, TargetPort: intstr.FromInt(probePort)}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("the Service could not be created: %v", err)
+		return result
+	}
+
+	address := net.JoinHostPort(pod.Status.HostIP, fmt.Sprint(svc.Spec.Ports[0].NodePort))
+	var lastErr error
+	err = wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		lastErr = dialProbe(ctx, address)
+		return lastErr == nil, nil
+	}, timeoutDone(ctx, 30*time.Second))
+
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("%s could not be reached, use --expose clusterip from the outer cluster: %v", address, lastErr)
+		return result
+	}
+
+	result.Status = CheckOK
+	result.Message = address + " is reachable"
+	return result
+}
+
+func dialProbe(ctx context.Context, address string) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(line) != "kink" {
+		return fmt.Errorf("unexpected answer %q", line)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the cluster does not exist
+	ErrNotFound = errors.New("kink cluster not found")
+	// ErrNotReady is returned when the cluster exists but its API server is not ready yet
+	ErrNotReady = errors.New("kink cluster is not ready")
+	// ErrTimeout is returned when the cluster does not become ready in time
+	ErrTimeout = errors.New("timed out waiting for the kink cluster to be ready")
+	// ErrPodFailed is returned when the pod of the cluster terminates while it is being created
+	ErrPodFailed = errors.New("pod of the kink cluster terminated")
+	// ErrUnsupportedVersion is returned when the Kubernetes version could not be used with the kind-cluster image
+	ErrUnsupportedVersion = errors.New("unsupported Kubernetes version")
+	// ErrInvalidSpec is returned when the spec of the cluster is not valid
+	ErrInvalidSpec = errors.New("invalid kink cluster spec")
+	// ErrNotPersistent is returned when a cluster without a PVC for its Docker storage is stopped
+	ErrNotPersistent = errors.New("kink cluster is not persistent")
+	// ErrStopped is returned when a cluster is created with the name of a stopped one
+	ErrStopped = errors.New("kink cluster is stopped, start it with \"kink start\" or delete it")
+	// ErrNotStopped is returned when a cluster which is not stopped is started
+	ErrNotStopped = errors.New("kink cluster is not stopped")
+	// ErrPoolNotFound is returned when the pool does not exist
+	ErrPoolNotFound = errors.New("kink pool not found")
+	// ErrPoolEmpty is returned when the pool does not have a ready cluster to claim
+	ErrPoolEmpty = errors.New("kink pool has no ready cluster to claim")
+)
+
+// ClusterError wraps the error of an operation on a cluster, errors.Is could be used to match
+// the underlying error such as ErrNotFound
+type ClusterError struct {
+	Op        string
+	Namespace string
+	Name      string
+	Err       error
+	// Rollback is set if the objects created by the failed operation are deleted
+	Rollback *Rollback
+}
+
+func (e *ClusterError) Error() string {
+	msg := fmt.Sprintf("%s %s/%s: %v", e.Op, e.Namespace, e.Name, e.Err)
+	if e.Rollback != nil {
+		msg += " (" + e.Rollback.String() + ")"
+	}
+	return msg
+}
+
+func (e *ClusterError) Unwrap() error {
+	return e.Err
+}
+
+func clusterError(op, namespace, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ClusterError{Op: op, Namespace: namespace, Name: name, Err: err}
+}
+
+// Rollback reports the objects deleted after a failed operation
+type Rollback struct {
+	Deleted []string
+	// Failed holds the errors of the objects which could not be deleted, they should be deleted by hand
+	Failed []error
+}
+
+func (r *Rollback) String() string {
+	deleted := "nothing"
+	if len(r.Deleted) > 0 {
+		deleted = strings.Join(r.Deleted, ", ")
+	}
+	msg := "rolled back: deleted " + deleted
+
+	if len(r.Failed) > 0 {
+		var failed []string
+		for _, err := range r.Failed {
+			failed = append(failed, err.Error())
+		}
+		msg += "; could not clean up: " + strings.Join(failed, ", ")
+	}
+	return msg
+}
@@ -0,0 +1,250 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// InnerCheck is a readiness check run against the KinD cluster itself, the probe of the pod only checks
+// that the API server is healthy
+type InnerCheck string
+
+const (
+	// InnerCheckNodes checks that all the nodes are Ready
+	InnerCheckNodes InnerCheck = "nodes"
+	// InnerCheckCoreDNS checks that the deployments of kube-system, including CoreDNS, are available
+	InnerCheckCoreDNS InnerCheck = "coredns"
+	// InnerCheckDefaultServiceAccount checks that the default ServiceAccount of the default namespace
+	// exists, the pods of the default namespace could not be created before
+	InnerCheckDefaultServiceAccount InnerCheck = "default-sa"
+)
+
+// DefaultInnerChecks are the checks run if the spec does not set them
+var DefaultInnerChecks = []InnerCheck{InnerCheckNodes, InnerCheckCoreDNS, InnerCheckDefaultServiceAccount}
+
+// ParseInnerChecks parses the names of the inner checks, "none" disables them
+func ParseInnerChecks(names []string) ([]InnerCheck, error) {
+	checks := []InnerCheck{}
+	for _, n := range names {
+		if n == "none" {
+			continue
+		}
+		check := InnerCheck(n)
+		if !check.valid() {
+			return nil, fmt.Errorf("%w: inner check %q should be one of nodes, coredns or default-sa", ErrInvalidSpec, n)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (ic InnerCheck) valid() bool {
+	for _, c := range DefaultInnerChecks {
+		if ic == c {
+			return true
+		}
+	}
+	return false
+}
+
+// pending returns why the check does not pass yet, it is empty once the check passes
+func (ic InnerCheck) pending(ctx context.Context, reader innerReader) (string, error) {
+	switch ic {
+	case InnerCheckNodes:
+		nodes, err := reader.nodes(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(nodes.Items) == 0 {
+			return "no nodes are registered", nil
+		}
+		var notReady []string
+		for _, n := range nodes.Items {
+			if !nodeReady(n) {
+				notReady = append(notReady, n.Name)
+			}
+		}
+		if len(notReady) > 0 {
+			return fmt.Sprintf("nodes %s are not Ready", strings.Join(notReady, ", ")), nil
+		}
+	case InnerCheckCoreDNS:
+		deployments, err := reader.deployments(ctx, metav1.NamespaceSystem)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, d := range deployments.Items {
+			found = found || d.Name == "coredns"
+			replicas := int32(1)
+			if d.Spec.Replicas != nil {
+				replicas = *d.Spec.Replicas
+			}
+			if d.Status.ObservedGeneration < d.Generation || d.Status.AvailableReplicas < replicas {
+				return fmt.Sprintf("deployment kube-system/%s has %d/%d available replicas", d.Name, d.Status.AvailableReplicas, replicas), nil
+			}
+		}
+		if !found {
+			return "deployment kube-system/coredns is not created yet", nil
+		}
+	case InnerCheckDefaultServiceAccount:
+		err := reader.serviceAccount(ctx, metav1.NamespaceDefault, "default")
+		if k8serrors.IsNotFound(err) {
+			return "ServiceAccount default/default is not created yet", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// innerReader reads the objects the inner checks need from the KinD cluster
+type innerReader interface {
+	nodes(ctx context.Context) (*corev1.NodeList, error)
+	deployments(ctx context.Context, namespace string) (*appsv1.DeploymentList, error)
+	serviceAccount(ctx context.Context, namespace, name string) error
+}
+
+// clientsetReader reads the objects with the kubeconfig of the cluster
+type clientsetReader struct {
+	clientset kubernetes.Interface
+}
+
+func (r clientsetReader) nodes(ctx context.Context) (*corev1.NodeList, error) {
+	return r.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+}
+
+func (r clientsetReader) deployments(ctx context.Context, namespace string) (*appsv1.DeploymentList, error) {
+	return r.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+}
+
+func (r clientsetReader) serviceAccount(ctx context.Context, namespace, name string) error {
+	_, err := r.clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	return err
+}
+
+// execReader reads the objects by running kubectl in the pod of the cluster, the same way its
+// kubeconfig is read, for the clusters kink could not reach such as ExposeClusterIP
+type execReader struct {
+	client    *Client
+	namespace string
+	name      string
+}
+
+func (r execReader) get(ctx context.Context, into interface{}, args ...string) error {
+	out, err := r.client.Exec(ctx, r.namespace, r.name, append([]string{"kubectl", "get", "-o", "json"}, args...))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(out), into)
+}
+
+func (r execReader) nodes(ctx context.Context) (*corev1.NodeList, error) {
+	nodes := &corev1.NodeList{}
+	return nodes, r.get(ctx, nodes, "nodes")
+}
+
+func (r execReader) deployments(ctx context.Context, namespace string) (*appsv1.DeploymentList, error) {
+	deployments := &appsv1.DeploymentList{}
+	return deployments, r.get(ctx, deployments, "deployments", "-n", namespace)
+}
+
+func (r execReader) serviceAccount(ctx context.Context, namespace, name string) error {
+	err := r.get(ctx, &corev1.ServiceAccount{}, "serviceaccount", name, "-n", namespace)
+	// kubectl reports the status of the API server on stderr, such as
+	// Error from server (NotFound): serviceaccounts "default" not found
+	if err != nil && strings.Contains(err.Error(), "(NotFound)") {
+		return k8serrors.NewNotFound(corev1.Resource("serviceaccounts"), name)
+	}
+	return err
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waitForInner runs the inner checks of the spec one by one until the deadline, the error names the
+// check which is still pending. They are run with the kubeconfig of the cluster, or by kubectl in its
+// pod for ExposeClusterIP which kink may not reach.
+func (c *Client) waitForInner(ctx context.Context, spec Spec, cluster *Cluster, deadline time.Time) error {
+	if len(spec.InnerChecks) == 0 {
+		return nil
+	}
+
+	var reader innerReader = execReader{client: c, namespace: cluster.Namespace, name: cluster.Name}
+	if cluster.Expose != ExposeClusterIP {
+		restConfig, err := cluster.RESTConfig()
+		if err != nil {
+			return err
+		}
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+		reader = clientsetReader{clientset: clientset}
+	}
+
+	done := timeoutDone(ctx, time.Until(deadline))
+	for _, check := range spec.InnerChecks {
+		var pending string
+		err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+			if spec.Progress != nil {
+				spec.Progress()
+			}
+
+			var err error
+			pending, err = check.pending(ctx, reader)
+			if err != nil {
+				// the API server may not serve every request right after it becomes healthy
+				pending = err.Error()
+				return false, nil
+			}
+			return pending == "", nil
+		}, done)
+
+		if errors.Is(err, wait.ErrWaitTimeout) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: inner check %s is pending: %s", ErrTimeout, check, pending)
+		}
+		if err != nil {
+			return err
+		}
+		c.logf("inner check %s passed\n", check)
+	}
+
+	return nil
+}
@@ -0,0 +1,584 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// LoadOptions describes the images to load into a cluster, exactly one of DockerImages, Archive or
+// OCILayout should be given
+type LoadOptions struct {
+	// ClusterName is the name of the KinD cluster, the one recorded on the pod is used if it is empty
+	ClusterName string
+
+	// DockerImages are taken from the local Docker daemon, the missing ones are pulled
+	DockerImages []string
+	// Archive is the path to a tarball produced by "docker save" or a compatible tool
+	Archive string
+	// OCILayout is the path to an OCI image layout directory
+	OCILayout string
+	// Arch is the architecture to pick from multi-platform images in an OCI layout
+	Arch string
+
+	// Force transfers and loads the images even if they are already present
+	Force bool
+	// Progress returns a writer which receives the image while it is transferred, it is closed once
+	// the transfer completes
+	Progress func(ref string, size int64) io.WriteCloser
+}
+
+// LoadedImage is an image on a node of the cluster
+type LoadedImage struct {
+	Node string
+	Ref  string
+	// ID is the ID of the image on the node, it is empty if the image is missing
+	ID string
+	// Skipped is true if the image was already present on the node
+	Skipped bool
+}
+
+// LoadImages loads the images into every node of the KinD cluster. Images are streamed into the Docker
+// daemon of the pod one by one, as soon as an image is there it is loaded into every node concurrently
+// while the next one is being streamed.
+func (c *Client) LoadImages(ctx context.Context, namespace, name string, opts LoadOptions) ([]LoadedImage, error) {
+	given := 0
+	for _, set := range []bool{len(opts.DockerImages) > 0, opts.Archive != "", opts.OCILayout != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, errors.New("exactly one of docker images, an archive or an OCI layout should be given")
+	}
+	if opts.Arch == "" {
+		opts.Arch = "amd64"
+	}
+
+	clusterName := opts.ClusterName
+	if clusterName == "" {
+		cluster, err := c.cluster(ctx, namespace, name)
+		if err != nil {
+			return nil, clusterError("load images", namespace, name, err)
+		}
+
+		clusterName = cluster.ClusterName
+		if clusterName == "" {
+			return nil, clusterError("load images", namespace, name, errors.New("could not find the KinD cluster name of the pod"))
+		}
+	}
+
+	var sources []imageSource
+	var err error
+	switch {
+	case opts.Archive != "":
+		sources, err = archiveSources(opts.Archive)
+	case opts.OCILayout != "":
+		sources, err = ociLayoutSources(opts.OCILayout, opts.Arch)
+	default:
+		sources, err = c.dockerSources(ctx, opts.DockerImages)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := c.loadSources(ctx, namespace, name, clusterName, sources, opts)
+	return loaded, clusterError("load images", namespace, name, err)
+}
+
+// loadSources loads the images into every node of the KinD cluster and returns their IDs on each node
+func (c *Client) loadSources(ctx context.Context, namespace, name, clusterName string, sources []imageSource, opts LoadOptions) ([]LoadedImage, error) {
+	nodes, err := c.Exec(ctx, namespace, name, []string{"kind", "get", "nodes", "--name", clusterName})
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes of KinD cluster %s: %w", clusterName, err)
+	}
+	nodeNames := strings.Fields(nodes)
+	if len(nodeNames) == 0 {
+		return nil, fmt.Errorf("KinD cluster %s has no nodes", clusterName)
+	}
+
+	// Images which are already present with the same ID are neither transferred nor loaded again
+	present := map[string]map[string]string{}
+	if !opts.Force {
+		for _, node := range nodeNames {
+			ids, err := c.nodeImages(ctx, namespace, name, node)
+			if err != nil {
+				return nil, fmt.Errorf("listing images of node %s: %w", node, err)
+			}
+			present[node] = ids
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var loadErrs []string
+	var transferred []string
+	skipped := map[string]bool{}
+	for _, src := range sources {
+		var missingNodes []string
+		for _, node := range nodeNames {
+			if !opts.Force && present[node][normalizeReference(src.ref)] == src.id {
+				c.logf("%s is already present on node %s, skipping\n", src.ref, node)
+				skipped[node+"/"+src.ref] = true
+				continue
+			}
+			missingNodes = append(missingNodes, node)
+		}
+
+		if len(missingNodes) == 0 {
+			continue
+		}
+
+		if !opts.Force && c.dindImageID(ctx, namespace, name, src.ref) == src.id {
+			c.logf("%s is already present in pod %s, skipping transfer\n", src.ref, name)
+		} else {
+			transferred = append(transferred, src.ref)
+			if err := c.streamImage(ctx, namespace, name, src, opts); err != nil {
+				wg.Wait()
+				if ctx.Err() != nil {
+					c.removeTransferred(namespace, name, transferred)
+				}
+				return nil, fmt.Errorf("streaming image %s: %w", src.ref, err)
+			}
+		}
+
+		for _, node := range missingNodes {
+			wg.Add(1)
+			go func(ref, node string) {
+				defer wg.Done()
+				args := []string{"kind", "load", "docker-image", ref, "--name", clusterName, "--nodes", node}
+				if _, err := c.Exec(ctx, namespace, name, args); err != nil {
+					mu.Lock()
+					loadErrs = append(loadErrs, fmt.Sprintf("loading image %s into node %s: %v", ref, node, err))
+					mu.Unlock()
+				}
+			}(src.ref, node)
+		}
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		c.removeTransferred(namespace, name, transferred)
+		return nil, ctx.Err()
+	}
+
+	if len(loadErrs) > 0 {
+		return nil, errors.New(strings.Join(loadErrs, "\n"))
+	}
+
+	var loaded []LoadedImage
+	for _, node := range nodeNames {
+		ids, err := c.nodeImages(ctx, namespace, name, node)
+		if err != nil {
+			return nil, fmt.Errorf("listing images of node %s: %w", node, err)
+		}
+
+		for _, src := range sources {
+			loaded = append(loaded, LoadedImage{
+				Node:    node,
+				Ref:     src.ref,
+				ID:      ids[normalizeReference(src.ref)],
+				Skipped: skipped[node+"/"+src.ref],
+			})
+		}
+	}
+
+	return loaded, nil
+}
+
+// archiveReferences returns the image references held by a "docker save" compatible tarball
+func archiveReferences(path string) ([]string, error) {
+	manifest, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", path, err)
+	}
+
+	var refs []string
+	for _, d := range manifest {
+		refs = append(refs, d.RepoTags...)
+	}
+
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("archive %s does not hold any tagged image", path)
+	}
+
+	return refs, nil
+}
+
+// ociLayoutImages returns the images in the OCI layout index keyed by the reference they are annotated with
+func ociLayoutImages(index v1.ImageIndex, arch string) (map[name.Reference]v1.Image, error) {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	refToImage := map[name.Reference]v1.Image{}
+	for _, desc := range indexManifest.Manifests {
+		refName := desc.Annotations["io.containerd.image.name"]
+		if refName == "" {
+			refName = desc.Annotations["org.opencontainers.image.ref.name"]
+		}
+		// a bare tag like "latest" does not tell us which repository the image belongs to
+		if refName == "" || !strings.ContainsAny(refName, "/:") {
+			return nil, fmt.Errorf("image %s in OCI layout is not annotated with a full image reference", desc.Digest)
+		}
+
+		ref, err := name.ParseReference(refName)
+		if err != nil {
+			return nil, err
+		}
+
+		var img v1.Image
+		switch {
+		case desc.MediaType.IsIndex():
+			img, err = platformImage(index, desc.Digest, arch)
+		case desc.MediaType.IsImage():
+			img, err = index.Image(desc.Digest)
+		default:
+			err = fmt.Errorf("unsupported media type %s", desc.MediaType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", refName, err)
+		}
+
+		refToImage[ref] = img
+	}
+
+	if len(refToImage) == 0 {
+		return nil, errors.New("OCI layout does not hold any image")
+	}
+
+	return refToImage, nil
+}
+
+// platformImage picks the linux image for the given architecture from a nested image index
+func platformImage(index v1.ImageIndex, h v1.Hash, arch string) (v1.Image, error) {
+	child, err := index.ImageIndex(h)
+	if err != nil {
+		return nil, err
+	}
+
+	childManifest, err := child.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range childManifest.Manifests {
+		if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == arch {
+			return child.Image(m.Digest)
+		}
+	}
+
+	return nil, fmt.Errorf("no linux/%s image found", arch)
+}
+
+// imageSource is an image which could be streamed as a "docker save" compatible tarball
+type imageSource struct {
+	ref  string
+	id   string
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// dockerSources returns the images from the local Docker daemon, pulling the missing ones
+func (c *Client) dockerSources(ctx context.Context, images []string) ([]imageSource, error) {
+	var sources []imageSource
+	for _, d := range images {
+		if err := isImageExistLocally(d); err != nil {
+			c.logf("%s is not found locally, pulling...\n", d)
+			command := exec.CommandContext(ctx, "docker", []string{"image", "pull", d}...) // #nosec G204
+			stderr, _ := command.StdoutPipe()
+			if err := command.Start(); err != nil {
+				return nil, err
+			}
+
+			scanner := bufio.NewScanner(stderr)
+			for scanner.Scan() {
+				c.logf("%s\n", scanner.Text())
+			}
+
+			if err := command.Wait(); err != nil {
+				return nil, err
+			}
+			c.logf("%s pulled successfully\n", d)
+		}
+
+		out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "-f", "{{ .Id }} {{ .Size }}", d).Output() // #nosec G204
+		if err != nil {
+			return nil, fmt.Errorf("inspecting image %s: %w", d, err)
+		}
+		fields := strings.Fields(string(out))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected output while inspecting image %s: %s", d, out)
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+
+		ref := d
+		sources = append(sources, imageSource{
+			ref:  ref,
+			id:   fields[0],
+			size: size,
+			open: func() (io.ReadCloser, error) {
+				return save(ctx, ref)
+			},
+		})
+	}
+
+	return sources, nil
+}
+
+// archiveSources returns the images held by a "docker save" compatible tarball
+func archiveSources(path string) ([]imageSource, error) {
+	refs, err := archiveReferences(path)
+	if err != nil {
+		return nil, err
+	}
+
+	refToImage := map[name.Reference]v1.Image{}
+	for _, r := range refs {
+		tag, err := name.NewTag(r)
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := tarball.ImageFromPath(path, &tag)
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s from %s: %w", r, path, err)
+		}
+		refToImage[tag] = img
+	}
+
+	return tarballSources(refToImage)
+}
+
+// ociLayoutSources returns the images held by an OCI layout
+func ociLayoutSources(path, arch string) ([]imageSource, error) {
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading OCI layout %s: %w", path, err)
+	}
+
+	refToImage, err := ociLayoutImages(index, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	return tarballSources(refToImage)
+}
+
+// tarballSources turns images into sources which are written as "docker save" compatible tarballs on the fly
+func tarballSources(refToImage map[name.Reference]v1.Image) ([]imageSource, error) {
+	var sources []imageSource
+	for ref, img := range refToImage {
+		ref, img := ref, img
+		single := map[name.Reference]v1.Image{ref: img}
+		size, err := tarball.CalculateSize(single)
+		if err != nil {
+			return nil, fmt.Errorf("calculating size of image %s: %w", ref.Name(), err)
+		}
+
+		id, err := img.ConfigName()
+		if err != nil {
+			return nil, fmt.Errorf("calculating ID of image %s: %w", ref.Name(), err)
+		}
+
+		sources = append(sources, imageSource{
+			ref:  ref.String(),
+			id:   id.String(),
+			size: size,
+			open: func() (io.ReadCloser, error) {
+				pr, pw := io.Pipe()
+				go func() {
+					pw.CloseWithError(tarball.MultiRefWrite(single, pw))
+				}()
+				return pr, nil
+			},
+		})
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].ref < sources[j].ref
+	})
+
+	return sources, nil
+}
+
+// streamImage pipes the image into "docker load" running inside the pod while reporting the progress
+func (c *Client) streamImage(ctx context.Context, namespace, name string, src imageSource, opts LoadOptions) error {
+	rc, err := src.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	var progress io.WriteCloser
+	if opts.Progress != nil {
+		progress = opts.Progress(src.ref, src.size)
+		r = io.TeeReader(rc, progress)
+	}
+
+	err = c.ExecStream(ctx, namespace, name, []string{"docker", "load"}, r, io.Discard, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		_ = progress.Close()
+	}
+
+	return rc.Close()
+}
+
+// removeTransferred removes the images transferred into the Docker daemon of the pod by a cancelled
+// load, the images which are loaded into the nodes so far are kept
+func (c *Client) removeTransferred(namespace, name string, refs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	for _, ref := range refs {
+		if _, err := c.Exec(ctx, namespace, name, []string{"docker", "image", "rm", ref}); err != nil {
+			c.logf("could not remove %s from pod %s: %v\n", ref, name, err)
+			continue
+		}
+		c.logf("removed %s from pod %s\n", ref, name)
+	}
+}
+
+// dindImageID returns the ID of the image in the Docker daemon of the pod, or an empty string if it is not there
+func (c *Client) dindImageID(ctx context.Context, namespace, name, ref string) string {
+	id, err := c.Exec(ctx, namespace, name, []string{"docker", "image", "inspect", "-f", "{{ .Id }}", ref})
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// criImages is the output of "crictl images -o json"
+type criImages struct {
+	Images []struct {
+		ID          string   `json:"id"`
+		RepoTags    []string `json:"repoTags"`
+		RepoDigests []string `json:"repoDigests"`
+	} `json:"images"`
+}
+
+// nodeImages returns the images that are present on a KinD node keyed by their normalized tags
+func (c *Client) nodeImages(ctx context.Context, namespace, name, node string) (map[string]string, error) {
+	out, err := c.Exec(ctx, namespace, name, []string{"docker", "exec", node, "crictl", "images", "-o", "json"})
+	if err != nil {
+		return nil, err
+	}
+
+	var images criImages
+	if err := json.Unmarshal([]byte(out), &images); err != nil {
+		return nil, fmt.Errorf("parsing images of node %s: %w", node, err)
+	}
+
+	ids := map[string]string{}
+	for _, img := range images.Images {
+		for _, t := range img.RepoTags {
+			ids[normalizeReference(t)] = img.ID
+		}
+	}
+
+	return ids, nil
+}
+
+// normalizeReference returns the fully qualified form of the reference the way containerd stores it
+func normalizeReference(ref string) string {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return ref
+	}
+
+	repo := r.Context().RepositoryStr()
+	registry := r.Context().RegistryStr()
+	if registry == name.DefaultRegistry {
+		registry = "docker.io"
+	}
+
+	return fmt.Sprintf("%s/%s%s%s", registry, repo, referenceDelimiter(r), r.Identifier())
+}
+
+func referenceDelimiter(r name.Reference) string {
+	if _, ok := r.(name.Digest); ok {
+		return "@"
+	}
+	return ":"
+}
+
+// isImageExistLocally returns error if image is not found locally
+func isImageExistLocally(imageName string) error {
+	if err := exec.Command("docker", "image", "inspect",
+		"-f", "{{ .Id }}",
+		imageName, // ... against the container
+	).Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// save streams the image, as in `docker save`, the command is killed when the context is cancelled
+func save(ctx context.Context, image string) (io.ReadCloser, error) {
+	command := exec.CommandContext(ctx, "docker", "save", image) // #nosec G204
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+
+	return &commandReadCloser{ReadCloser: stdout, command: command}, nil
+}
+
+// commandReadCloser waits for the command to exit when it is closed
+type commandReadCloser struct {
+	io.ReadCloser
+	command *exec.Cmd
+	once    sync.Once
+	err     error
+}
+
+func (c *commandReadCloser) Close() error {
+	c.once.Do(func() {
+		_ = c.ReadCloser.Close()
+		c.err = c.command.Wait()
+	})
+	return c.err
+}
@@ -0,0 +1,440 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// poolSpecKey is the key of the ConfigMap data holding the spec of the pool
+const poolSpecKey = "spec.json"
+
+// poolParallelism is the number of clusters of a pool created at the same time, the same as the
+// default of "kink run --parallelism", so that a large pool does not flood the outer cluster
+const poolParallelism = 4
+
+// PoolSpec describes a pool of ready clusters waiting to be claimed, it is stored in a ConfigMap so
+// that any kink invocation could reconcile the pool
+type PoolSpec struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Size is the number of ready, unclaimed clusters to keep
+	Size int `json:"size"`
+
+	KubernetesVersion   string                      `json:"kubernetesVersion,omitempty"`
+	Image               string                      `json:"image,omitempty"`
+	NodeImageRepository string                      `json:"nodeImageRepository,omitempty"`
+	NodeImage           string                      `json:"nodeImage,omitempty"`
+	ImagePullSecrets    []string                    `json:"imagePullSecrets,omitempty"`
+	ImagePullPolicy     corev1.PullPolicy           `json:"imagePullPolicy,omitempty"`
+	Resources           corev1.ResourceRequirements `json:"resources,omitempty"`
+	Expose              ExposeMode                  `json:"expose,omitempty"`
+	WithRegistry        bool                        `json:"withRegistry,omitempty"`
+	RegistryMirrors     []string                    `json:"registryMirrors,omitempty"`
+	InsecureRegistries  []string                    `json:"insecureRegistries,omitempty"`
+	Timeout             metav1.Duration             `json:"timeout,omitempty"`
+}
+
+// PoolStatus is the capacity of a pool
+type PoolStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Size      int    `json:"size"`
+	// Ready clusters could be claimed, Creating ones are not ready yet
+	Ready    int `json:"ready"`
+	Creating int `json:"creating"`
+	Claimed  int `json:"claimed"`
+}
+
+// ClaimOptions are stamped on the claimed cluster
+type ClaimOptions struct {
+	// Owner is the owner label of the claimant, DefaultOwner is used if it is empty
+	Owner string
+	// TTL starts when the cluster is claimed, the cluster does not expire if it is zero
+	TTL    time.Duration
+	Labels map[string]string
+}
+
+// poolOwner is the owner of the clusters of the pool until they are claimed
+func poolOwner(pool string) string {
+	return "pool_" + pool
+}
+
+func poolConfigMapName(pool string) string {
+	return "kink-pool-" + pool
+}
+
+func poolSelector(pool string, claimed bool) string {
+	return fmt.Sprintf("%s=%s,%s=%t", types.PoolLabel, pool, types.PoolClaimedLabel, claimed)
+}
+
+// clusterSpec returns the spec of a new cluster of the pool
+func (p *PoolSpec) clusterSpec() Spec {
+	return Spec{
+		Name:                fmt.Sprintf("%s-%s", p.Name, rand.String(5)),
+		Namespace:           p.Namespace,
+		KubernetesVersion:   p.KubernetesVersion,
+		Image:               p.Image,
+		NodeImageRepository: p.NodeImageRepository,
+		NodeImage:           p.NodeImage,
+		ImagePullSecrets:    p.ImagePullSecrets,
+		ImagePullPolicy:     p.ImagePullPolicy,
+		Resources:           p.Resources,
+		Expose:              p.Expose,
+		Owner:               poolOwner(p.Name),
+		Labels: map[string]string{
+			types.PoolLabel:        p.Name,
+			types.PoolClaimedLabel: "false",
+		},
+		WithRegistry:       p.WithRegistry,
+		RegistryMirrors:    p.RegistryMirrors,
+		InsecureRegistries: p.InsecureRegistries,
+		Timeout:            p.Timeout.Duration,
+	}
+}
+
+// ApplyPool creates the pool or updates its spec, the clusters are created by ReconcilePool
+func (c *Client) ApplyPool(ctx context.Context, pool PoolSpec) error {
+	if pool.Namespace == "" {
+		pool.Namespace = "default"
+	}
+	if pool.Size < 0 {
+		return fmt.Errorf("%w: pool size should not be negative", ErrInvalidSpec)
+	}
+	if _, err := pool.clusterSpec().withDefaults(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(pool)
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        poolConfigMapName(pool.Name),
+			Namespace:   pool.Namespace,
+			Annotations: kubernetes.ManagedAnnotations(),
+			Labels:      map[string]string{types.PoolLabel: pool.Name},
+		},
+		Data: map[string]string{poolSpecKey: string(data)},
+	}
+
+	cmClient := c.clientset.CoreV1().ConfigMaps(pool.Namespace)
+	_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		var existing *corev1.ConfigMap
+		existing, err = cmClient.Get(ctx, cm.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Data = cm.Data
+		_, err = cmClient.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("saving pool %s/%s: %w", pool.Namespace, pool.Name, err)
+	}
+
+	return nil
+}
+
+// GetPool returns the spec of the pool
+func (c *Client) GetPool(ctx context.Context, namespace, name string) (*PoolSpec, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, poolConfigMapName(name), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrPoolNotFound
+		}
+		return nil, fmt.Errorf("getting pool %s/%s: %w", namespace, name, err)
+	}
+
+	return poolFromConfigMap(cm)
+}
+
+func poolFromConfigMap(cm *corev1.ConfigMap) (*PoolSpec, error) {
+	pool := &PoolSpec{}
+	if err := json.Unmarshal([]byte(cm.Data[poolSpecKey]), pool); err != nil {
+		return nil, fmt.Errorf("parsing pool %s/%s: %w", cm.Namespace, cm.Labels[types.PoolLabel], err)
+	}
+	return pool, nil
+}
+
+// DeletePool deletes the pool and its unclaimed clusters, the claimed ones belong to their claimants
+func (c *Client) DeletePool(ctx context.Context, namespace, name string) error {
+	err := c.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, poolConfigMapName(name), metav1.DeleteOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrPoolNotFound
+		}
+		return fmt.Errorf("deleting pool %s/%s: %w", namespace, name, err)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: poolSelector(name, false)})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pods.Items {
+		c.logf("deleting the unclaimed cluster %s\n", p.Name)
+		if err := c.Delete(ctx, namespace, p.Name, false); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReconcilePool creates clusters until the pool has as many unclaimed clusters as its size, and deletes
+// the failed and the surplus ones. It returns the number of the created clusters.
+func (c *Client) ReconcilePool(ctx context.Context, namespace, name string) (int, error) {
+	pool, err := c.GetPool(ctx, namespace, name)
+	if err != nil {
+		return 0, err
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: poolSelector(name, false)})
+	if err != nil {
+		return 0, err
+	}
+
+	var alive []corev1.Pod
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		if p.Status.Phase == corev1.PodFailed || p.Status.Phase == corev1.PodSucceeded {
+			c.logf("deleting the terminated cluster %s\n", p.Name)
+			if err := c.Delete(ctx, namespace, p.Name, false); err != nil && !errors.Is(err, ErrNotFound) {
+				return 0, err
+			}
+			continue
+		}
+		alive = append(alive, p)
+	}
+
+	// the clusters which are not ready yet are deleted first when the pool is shrunk
+	sort.SliceStable(alive, func(i, j int) bool {
+		return !isContainersReady(alive[i]) && isContainersReady(alive[j])
+	})
+	for len(alive) > pool.Size {
+		c.logf("deleting the surplus cluster %s\n", alive[0].Name)
+		if err := c.Delete(ctx, namespace, alive[0].Name, false); err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+		alive = alive[1:]
+	}
+
+	missing := pool.Size - len(alive)
+	if missing <= 0 {
+		return 0, nil
+	}
+
+	c.logf("creating %d clusters for pool %s\n", missing, name)
+	errs := make([]error, missing)
+	sem := make(chan struct{}, poolParallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < missing; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			_, errs[i] = c.Create(ctx, pool.clusterSpec())
+		}(i)
+	}
+	wg.Wait()
+
+	var created int
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		created++
+	}
+	if len(failed) > 0 {
+		return created, fmt.Errorf("reconciling pool %s/%s: %s", namespace, name, strings.Join(failed, "; "))
+	}
+
+	return created, nil
+}
+
+// Claim takes a ready cluster of the pool and stamps the owner, the TTL and the labels of the claimant
+// on it. The cluster is updated with the resource version it is listed with, so a cluster could not
+// be claimed twice by concurrent claims.
+func (c *Client) Claim(ctx context.Context, namespace, pool string, opts ClaimOptions) (*Cluster, error) {
+	owner := opts.Owner
+	if owner == "" {
+		var err error
+		owner, err = DefaultOwner()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: poolSelector(pool, false)})
+	if err != nil {
+		return nil, err
+	}
+
+	// the oldest clusters are claimed first
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+
+	podClient := c.clientset.CoreV1().Pods(namespace)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !isContainersReady(*pod) {
+			continue
+		}
+
+		labels := claimedLabels(pod.Labels, owner, opts.Labels)
+		pod.Labels = labels
+		if opts.TTL > 0 {
+			if pod.Annotations == nil {
+				pod.Annotations = map[string]string{}
+			}
+			pod.Annotations[types.TTLAnnotation] = opts.TTL.String()
+			pod.Annotations[types.ExpiresAtAnnotation] = time.Now().Add(opts.TTL).UTC().Format(time.RFC3339)
+		}
+
+		_, err := podClient.Update(ctx, pod, metav1.UpdateOptions{})
+		if k8serrors.IsConflict(err) || k8serrors.IsNotFound(err) {
+			c.logf("cluster %s is claimed by someone else, trying another one\n", pod.Name)
+			continue
+		}
+		if err != nil {
+			return nil, clusterError("claim", namespace, pod.Name, err)
+		}
+
+		if err := c.relabelService(ctx, namespace, pod.Name, owner, opts.Labels); err != nil {
+			return nil, clusterError("claim", namespace, pod.Name, err)
+		}
+
+		return c.Get(ctx, namespace, pod.Name)
+	}
+
+	return nil, fmt.Errorf("claiming from pool %s/%s: %w", namespace, pool, ErrPoolEmpty)
+}
+
+// relabelService puts the labels of the claimant on the service of the claimed cluster
+func (c *Client) relabelService(ctx context.Context, namespace, name, owner string, extra map[string]string) error {
+	svcClient := c.clientset.CoreV1().Services(namespace)
+	svc, err := svcClient.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	svc.Labels = claimedLabels(svc.Labels, owner, extra)
+	_, err = svcClient.Update(ctx, svc, metav1.UpdateOptions{})
+	return err
+}
+
+// claimedLabels returns the labels of a cluster of a pool after it is claimed by the owner
+func claimedLabels(labels map[string]string, owner string, extra map[string]string) map[string]string {
+	claimed := map[string]string{}
+	for k, v := range labels {
+		claimed[k] = v
+	}
+	for k, v := range extra {
+		claimed[k] = v
+	}
+	claimed[types.OwnerLabel] = owner
+	claimed[types.PoolClaimedLabel] = "true"
+	return claimed
+}
+
+// PoolStatus returns the capacity of the pool
+func (c *Client) PoolStatus(ctx context.Context, namespace, name string) (*PoolStatus, error) {
+	pool, err := c.GetPool(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.poolStatus(ctx, pool)
+}
+
+// ListPools returns the capacity of the pools in the namespace
+func (c *Client) ListPools(ctx context.Context, namespace string) ([]*PoolStatus, error) {
+	cms, err := c.clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: types.PoolLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*PoolStatus, 0, len(cms.Items))
+	for i := range cms.Items {
+		pool, err := poolFromConfigMap(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+
+		status, err := c.poolStatus(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (c *Client) poolStatus(ctx context.Context, pool *PoolSpec) (*PoolStatus, error) {
+	pods, err := c.clientset.CoreV1().Pods(pool.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.PoolLabel, pool.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PoolStatus{Name: pool.Name, Namespace: pool.Namespace, Size: pool.Size}
+	for _, p := range pods.Items {
+		switch {
+		case p.Labels[types.PoolClaimedLabel] == "true":
+			status.Claimed++
+		case p.DeletionTimestamp != nil:
+		case isContainersReady(p):
+			status.Ready++
+		default:
+			status.Creating++
+		}
+	}
+
+	return status, nil
+}
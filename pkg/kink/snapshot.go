@@ -0,0 +1,473 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// snapshotInfoFile is the entry of the snapshot holding the recorded cluster config
+	snapshotInfoFile = "cluster.json"
+	// snapshotDir is where the snapshot is prepared in the pod of the cluster, it is on the disk
+	// unlike /tmp
+	snapshotDir = "/var/lib/docker/kink-snapshot"
+	// snapshotMountPath is where the snapshot is mounted in the pod of the restored cluster
+	snapshotMountPath = "/kink-snapshot"
+	// snapshotReadyTimeout is how long to wait for the nodes to be ready after the snapshot is taken
+	snapshotReadyTimeout = 5 * time.Minute
+)
+
+// snapshotScript stops the KinD nodes, commits them along with their /var volumes which are not in
+// the committed images, and starts them again
+const snapshotScript = `set -o errexit -o nounset -o pipefail
+cluster="$1"
+dir="$2"
+rm -rf "${dir}" && mkdir -p "${dir}"
+
+nodes=$(kind get nodes --name "${cluster}")
+docker network inspect kind -f '{{(index .IPAM.Config 0).Subnet}}' > "${dir}/network"
+for node in ${nodes}; do
+  role=$(docker inspect -f '{{index .Config.Labels "io.x-k8s.kind.role"}}' "${node}")
+  ip=$(docker inspect -f '{{.NetworkSettings.Networks.kind.IPAddress}}' "${node}")
+  echo "${node} ${role} ${ip}" >> "${dir}/nodes"
+done
+
+docker stop ${nodes} > /dev/null
+trap 'docker start ${nodes} > /dev/null' EXIT
+
+images=""
+for node in ${nodes}; do
+  image="kink-snapshot/${node}:latest"
+  docker commit "${node}" "${image}" > /dev/null
+  docker run --rm --volumes-from "${node}" -v "${dir}:/snapshot" --entrypoint tar "${image}" \
+    -C /var -cf "/snapshot/${node}-var.tar" .
+  images="${images} ${image}"
+done
+
+docker save -o "${dir}/images.tar" ${images}
+docker rmi ${images} > /dev/null
+`
+
+// SnapshotInfo is the config of the cluster a snapshot is taken from
+type SnapshotInfo struct {
+	// Source is the cluster the snapshot is taken from, such as default/my-cluster
+	Source            string    `json:"source"`
+	ClusterName       string    `json:"clusterName"`
+	Image             string    `json:"image"`
+	NodeImage         string    `json:"nodeImage"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// SnapshotSource is the snapshot a cluster is restored from, one of the fields should be set
+type SnapshotSource struct {
+	// File is the path of an archive written by Snapshot, it is uploaded to the pod
+	File string
+	// Claim is the name of a PVC written by SnapshotToClaim, it is mounted to the pod
+	Claim string
+}
+
+func (s *SnapshotSource) String() string {
+	if s.Claim != "" {
+		return "pvc/" + s.Claim
+	}
+	return s.File
+}
+
+// Snapshot writes a snapshot of the cluster to w as a gzipped tar archive. The KinD nodes are stopped
+// while they are saved, and they are started again before it returns.
+func (c *Client) Snapshot(ctx context.Context, namespace, name string, w io.Writer) (*SnapshotInfo, error) {
+	cluster, err := c.cluster(ctx, namespace, name)
+	if err != nil {
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+	if !cluster.Ready {
+		return nil, clusterError("snapshot", namespace, name, ErrNotReady)
+	}
+
+	info := &SnapshotInfo{
+		Source:            namespace + "/" + name,
+		ClusterName:       cluster.ClusterName,
+		Image:             cluster.Image,
+		NodeImage:         cluster.NodeImage,
+		KubernetesVersion: cluster.KubernetesVersion,
+		CreatedAt:         time.Now().UTC(),
+	}
+
+	c.logf("stopping the nodes of %s/%s and saving them\n", namespace, name)
+	_, err = c.Exec(ctx, namespace, name, []string{"bash", "-c", snapshotScript, "snapshot", cluster.ClusterName, snapshotDir})
+	defer c.resumeAfterSnapshot(namespace, name)
+	if err != nil {
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+
+	if err := c.writeSnapshot(ctx, namespace, name, info, w); err != nil {
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+
+	return info, nil
+}
+
+// writeSnapshot streams the prepared snapshot out of the pod and writes it along with the info
+func (c *Client) writeSnapshot(ctx context.Context, namespace, name string, info *SnapshotInfo, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the info is the first entry so that it could be read without reading the whole archive
+	err = tw.WriteHeader(&tar.Header{
+		Name:    snapshotInfoFile,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: info.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	execCtx, cancelExec := context.WithCancel(ctx)
+	execDone := make(chan struct{})
+	go func() {
+		defer close(execDone)
+		pw.CloseWithError(c.ExecStream(execCtx, namespace, name, []string{"tar", "-C", snapshotDir, "-cf", "-", "."}, nil, pw, &stderr))
+	}()
+	// the exec writes to stderr until it returns
+	stopExec := func() {
+		cancelExec()
+		pr.Close()
+		<-execDone
+	}
+	defer stopExec()
+
+	tr := tar.NewReader(pr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stopExec()
+			return fmt.Errorf("reading snapshot: %w %s", err, stderr.String())
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// resumeAfterSnapshot removes the prepared snapshot and waits for the nodes to be ready again, the
+// context of the snapshot is not used since it may have been cancelled
+func (c *Client) resumeAfterSnapshot(namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotReadyTimeout)
+	defer cancel()
+
+	if _, err := c.Exec(ctx, namespace, name, []string{"rm", "-rf", snapshotDir}); err != nil {
+		c.logf("could not remove the snapshot from %s/%s: %v\n", namespace, name, err)
+	}
+
+	c.logf("waiting for the nodes of %s/%s to be ready again\n", namespace, name)
+	script := fmt.Sprintf(`until kubectl get --raw /readyz > /dev/null 2>&1; do sleep 1; done
+kubectl wait --for=condition=Ready nodes --all --timeout=%ds`, int(snapshotReadyTimeout.Seconds()))
+	if _, err := c.Exec(ctx, namespace, name, []string{"bash", "-c", script}); err != nil {
+		c.logf("nodes of %s/%s are not ready after the snapshot: %v\n", namespace, name, err)
+	}
+}
+
+// SnapshotToClaim writes a snapshot of the cluster to the PVC, which should already exist. The
+// snapshot is written by a short-lived pod mounting the PVC, and its info is recorded on the PVC.
+func (c *Client) SnapshotToClaim(ctx context.Context, namespace, name, claim string) (*SnapshotInfo, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+
+	pvcClient := c.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	if _, err := pvcClient.Get(ctx, claim, metav1.GetOptions{}); err != nil {
+		return nil, clusterError("snapshot", namespace, name, fmt.Errorf("getting PVC %s: %w", claim, err))
+	}
+
+	writer, err := c.startSnapshotWriter(ctx, pod, claim)
+	if err != nil {
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+	defer func() {
+		err := c.clientset.CoreV1().Pods(namespace).Delete(context.Background(), writer, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			c.logf("could not delete pod %s/%s: %v\n", namespace, writer, err)
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	var info *SnapshotInfo
+	snapshotErr := make(chan error, 1)
+	go func() {
+		var err error
+		info, err = c.Snapshot(ctx, namespace, name, pw)
+		pw.CloseWithError(err)
+		snapshotErr <- err
+	}()
+
+	// the ready marker is written last so that a partial snapshot is never restored
+	var stderr bytes.Buffer
+	script := "rm -rf /snapshot/* && tar -xzf - -C /snapshot && touch /snapshot/ready"
+	err = c.ExecStream(ctx, namespace, writer, []string{"sh", "-c", script}, pr, io.Discard, &stderr)
+	pr.Close()
+	if serr := <-snapshotErr; serr != nil {
+		return nil, serr
+	}
+	if err != nil {
+		return nil, clusterError("snapshot", namespace, name, fmt.Errorf("writing to PVC %s: %w %s", claim, err, stderr.String()))
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	pvc, err := pvcClient.Get(ctx, claim, metav1.GetOptions{})
+	if err != nil {
+		return nil, clusterError("snapshot", namespace, name, err)
+	}
+	if pvc.Annotations == nil {
+		pvc.Annotations = map[string]string{}
+	}
+	pvc.Annotations[types.SnapshotAnnotation] = string(data)
+	if _, err := pvcClient.Update(ctx, pvc, metav1.UpdateOptions{}); err != nil {
+		return nil, clusterError("snapshot", namespace, name, fmt.Errorf("recording the snapshot on PVC %s: %w", claim, err))
+	}
+
+	return info, nil
+}
+
+// startSnapshotWriter starts a pod mounting the PVC and returns its name once it is running. It runs
+// the image of the cluster with its pull secrets, and its name is random so that it could not collide
+// with a cluster.
+func (c *Client) startSnapshotWriter(ctx context.Context, source *corev1.Pod, claim string) (string, error) {
+	namespace := source.Namespace
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-snapshot-%s", source.Name, rand.String(5)),
+			Namespace:   namespace,
+			Annotations: kubernetes.ManagedAnnotations(),
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: source.Spec.ImagePullSecrets,
+			Volumes: []corev1.Volume{
+				{
+					Name: "snapshot",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					// the name is shared with the clusters to exec into it
+					Name:         containerName,
+					Image:        clusterFromPod(source, nil).Image,
+					Command:      []string{"sleep", "infinity"},
+					VolumeMounts: []corev1.VolumeMount{{Name: "snapshot", MountPath: "/snapshot"}},
+				},
+			},
+		},
+	}
+
+	if _, err := c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("creating the pod writing to PVC %s: %w", claim, err)
+	}
+
+	if err := c.waitForRunning(ctx, namespace, pod.Name, snapshotReadyTimeout); err != nil {
+		return pod.Name, fmt.Errorf("waiting for the pod writing to PVC %s: %w", claim, err)
+	}
+
+	return pod.Name, nil
+}
+
+// waitForRunning waits until the container of the pod is running
+func (c *Client) waitForRunning(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, ErrPodFailed
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == containerName && cs.State.Running != nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, timeoutDone(ctx, timeout))
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrTimeout
+	}
+	return err
+}
+
+// ReadSnapshotInfo returns the info of the snapshot archive
+func ReadSnapshotInfo(path string) (*SnapshotInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("reading snapshot %s: %s is not found", path, snapshotInfoFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+		}
+		if hdr.Name != snapshotInfoFile {
+			continue
+		}
+
+		info := &SnapshotInfo{}
+		if err := json.NewDecoder(tr).Decode(info); err != nil {
+			return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+		}
+		return info, nil
+	}
+}
+
+// ClaimSnapshotInfo returns the info of the snapshot written to the PVC
+func (c *Client) ClaimSnapshotInfo(ctx context.Context, namespace, claim string) (*SnapshotInfo, error) {
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, claim, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting PVC %s: %w", claim, err)
+	}
+
+	data, ok := pvc.Annotations[types.SnapshotAnnotation]
+	if !ok {
+		return nil, fmt.Errorf("PVC %s does not hold a snapshot", claim)
+	}
+
+	info := &SnapshotInfo{}
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		return nil, fmt.Errorf("reading the snapshot of PVC %s: %w", claim, err)
+	}
+	return info, nil
+}
+
+// snapshotInfo returns the info of the snapshot the cluster is restored from
+func (c *Client) snapshotInfo(ctx context.Context, namespace string, s *SnapshotSource) (*SnapshotInfo, error) {
+	switch {
+	case s.Claim != "" && s.File != "":
+		return nil, fmt.Errorf("%w: snapshot should be either a file or a PVC", ErrInvalidSpec)
+	case s.Claim != "":
+		return c.ClaimSnapshotInfo(ctx, namespace, s.Claim)
+	case s.File != "":
+		return ReadSnapshotInfo(s.File)
+	}
+	return nil, fmt.Errorf("%w: snapshot is empty", ErrInvalidSpec)
+}
+
+// addSnapshotVolume mounts the snapshot to the pod, the entrypoint restores the nodes from it
+func addSnapshotVolume(pod *corev1.Pod, s *SnapshotSource) {
+	source := corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	if s.Claim != "" {
+		source = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: s.Claim, ReadOnly: true},
+		}
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: "snapshot", VolumeSource: source})
+	container := &pod.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "snapshot",
+		MountPath: snapshotMountPath,
+		ReadOnly:  s.Claim != "",
+	})
+	container.Env = append(container.Env, corev1.EnvVar{Name: "KINK_SNAPSHOT_DIR", Value: snapshotMountPath})
+	pod.Annotations[types.SnapshotAnnotation] = s.String()
+}
+
+// uploadSnapshot uploads the snapshot file to the pod once its container is running
+func (c *Client) uploadSnapshot(ctx context.Context, spec Spec) error {
+	if err := c.waitForRunning(ctx, spec.Namespace, spec.Name, spec.Timeout); err != nil {
+		return fmt.Errorf("waiting for the pod to upload the snapshot: %w", err)
+	}
+
+	f, err := os.Open(spec.Snapshot.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.logf("uploading snapshot %s\n", spec.Snapshot.File)
+	script := fmt.Sprintf("tar -xzf - -C %[1]s && touch %[1]s/ready", snapshotMountPath)
+	var stderr bytes.Buffer
+	if err := c.ExecStream(ctx, spec.Namespace, spec.Name, []string{"sh", "-c", script}, f, io.Discard, &stderr); err != nil {
+		return fmt.Errorf("uploading snapshot: %w %s", err, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/compat"
+	"github.com/Trendyol/kink/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ExposeMode is how the API server of the cluster is exposed to its clients
+type ExposeMode string
+
+const (
+	// ExposeNodePort exposes the API server on a NodePort of the outer cluster
+	ExposeNodePort ExposeMode = "nodeport"
+	// ExposeClusterIP exposes the API server only to the clients running in the outer cluster
+	ExposeClusterIP ExposeMode = "clusterip"
+)
+
+// serviceType returns the type of the Service in front of the API server
+func (m ExposeMode) serviceType() (corev1.ServiceType, error) {
+	switch m {
+	case ExposeNodePort, "":
+		return corev1.ServiceTypeNodePort, nil
+	case ExposeClusterIP:
+		return corev1.ServiceTypeClusterIP, nil
+	}
+	return "", fmt.Errorf("%w: expose mode %q should be one of nodeport or clusterip", ErrInvalidSpec, m)
+}
+
+// Spec describes the cluster to create, the zero values fall back to the defaults
+type Spec struct {
+	// Name is the name of the pod and the service of the cluster
+	Name      string
+	Namespace string
+	// ClusterName is the name of the KinD cluster, a unique one is generated if it is empty
+	ClusterName string
+
+	// KubernetesVersion could be a full version, a partial one such as 1.21, latest or stable-N
+	KubernetesVersion   string
+	Image               string
+	NodeImageRepository string
+	// NodeImage is the full reference of the node image, it overrides KubernetesVersion
+	NodeImage        string
+	ImagePullSecrets []string
+	ImagePullPolicy  corev1.PullPolicy
+	// CompatMatrix is used to check the node version against the image, the embedded one is used if it is nil
+	CompatMatrix *compat.Matrix
+
+	Resources corev1.ResourceRequirements
+	TTL       time.Duration
+	Expose    ExposeMode
+	// Owner is the value of the label used to find the clusters of a user, see DefaultOwner
+	Owner string
+	// Labels are put on the pod and the service in addition to the ones kink uses
+	Labels map[string]string
+
+	WithRegistry bool
+	// RegistryMirrors are in the form of host=url, a bare url mirrors Docker Hub
+	RegistryMirrors    []string
+	InsecureRegistries []string
+	// Ports of the KinD control-plane node are published on the pod and the Service, such as the host
+	// ports of an ingress controller
+	Ports []int32
+
+	// Persistent keeps the Docker storage of the pod on a PVC, so that the cluster could be stopped and
+	// started again without losing its state
+	Persistent bool
+	// StorageSize is the size of the PVC, it defaults to 20Gi
+	StorageSize resource.Quantity
+	// StorageClass is the storage class of the PVC, the default class is used if it is empty
+	StorageClass string
+
+	// Snapshot is the snapshot to restore the cluster from, the cluster name and the node image of
+	// the snapshot are used
+	Snapshot *SnapshotSource
+
+	// InnerChecks are run against the KinD cluster before it is declared ready, DefaultInnerChecks are
+	// run if it is nil and none if it is empty
+	InnerChecks []InnerCheck
+
+	// Timeout is how long to wait for the cluster to be ready, including the inner checks
+	Timeout time.Duration
+	// Progress is called on every check while waiting for the cluster to be ready
+	Progress func()
+}
+
+// withDefaults returns the spec with its zero values replaced by the defaults
+func (s Spec) withDefaults() (Spec, error) {
+	if s.Name == "" {
+		return s, fmt.Errorf("%w: name is required", ErrInvalidSpec)
+	}
+	if s.Namespace == "" {
+		s.Namespace = "default"
+	}
+	if s.KubernetesVersion == "" {
+		s.KubernetesVersion = types.NodeImageTag
+	}
+	if s.Image == "" {
+		s.Image = types.ImageRepository + ":" + types.ImageTag
+	}
+	if s.NodeImageRepository == "" {
+		s.NodeImageRepository = types.NodeImageRepository
+	}
+	if s.ImagePullPolicy == "" {
+		s.ImagePullPolicy = corev1.PullIfNotPresent
+	}
+	if s.Timeout == 0 {
+		s.Timeout = 240 * time.Second
+	}
+	for _, p := range s.Ports {
+		if p < 1 || p > 65535 || p == apiServerPort {
+			return s, fmt.Errorf("%w: port %d could not be published", ErrInvalidSpec, p)
+		}
+	}
+	if s.InnerChecks == nil {
+		s.InnerChecks = DefaultInnerChecks
+	}
+	for _, ic := range s.InnerChecks {
+		if !ic.valid() {
+			return s, fmt.Errorf("%w: unknown inner check %q", ErrInvalidSpec, ic)
+		}
+	}
+	if s.StorageSize.IsZero() {
+		s.StorageSize = resource.MustParse("20Gi")
+	}
+	if s.CompatMatrix == nil {
+		m, err := compat.Load("")
+		if err != nil {
+			return s, err
+		}
+		s.CompatMatrix = m
+	}
+
+	switch s.ImagePullPolicy {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return s, fmt.Errorf("%w: image pull policy %q should be one of Always, IfNotPresent or Never", ErrInvalidSpec, s.ImagePullPolicy)
+	}
+
+	if s.Owner == "" {
+		owner, err := DefaultOwner()
+		if err != nil {
+			return s, err
+		}
+		s.Owner = owner
+	}
+	if errs := validation.IsValidLabelValue(s.Owner); len(errs) > 0 {
+		return s, fmt.Errorf("%w: owner %q: %s", ErrInvalidSpec, s.Owner, strings.Join(errs, ", "))
+	}
+
+	return s, nil
+}
+
+// DefaultOwner returns the owner of the clusters created by the current user on this host
+func DefaultOwner() (string, error) {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s_%s", currentUser.Username, hostname), nil
+}
+
+// OwnerSelector returns the label selector of the clusters of the owner
+func OwnerSelector(owner string) string {
+	return fmt.Sprintf("%s=%s", types.OwnerLabel, owner)
+}
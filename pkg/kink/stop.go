@@ -0,0 +1,262 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kubernetes"
+	"github.com/Trendyol/kink/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// storageVolume is the volume of the pod holding the Docker storage, the KinD nodes live in it
+const storageVolume = "varlibdocker"
+
+// storageName returns the name of the PVC holding the Docker storage of a persistent cluster
+func storageName(name string) string {
+	return name + "-docker"
+}
+
+// stopNodesTimeout is how long to wait for the containers in the pod to stop before the pod is deleted
+const stopNodesTimeout = 2 * time.Minute
+
+// stopNodesScript stops the KinD nodes and then the other containers, such as the local registry, so
+// that the Docker storage is consistent when the pod is deleted. The shell of the pod ignores SIGTERM,
+// so they would be killed otherwise once the grace period is over.
+const stopNodesScript = `set -o errexit -o nounset -o pipefail
+nodes=$(docker ps -q --filter "label=io.x-k8s.kind.cluster=$1")
+if [ -n "${nodes}" ]; then
+  docker stop ${nodes} > /dev/null
+fi
+others=$(docker ps -q)
+if [ -n "${others}" ]; then
+  docker stop ${others} > /dev/null
+fi
+sync`
+
+// StartOptions are used while waiting for the started cluster to be ready
+type StartOptions struct {
+	// Timeout is how long to wait for the cluster to be ready, it defaults to 240 seconds
+	Timeout time.Duration
+	// Progress is called on every check while waiting for the cluster to be ready
+	Progress func()
+}
+
+// createStorage creates the PVC holding the Docker storage of the persistent cluster
+func (c *Client) createStorage(ctx context.Context, spec Spec, labels map[string]string) error {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        storageName(spec.Name),
+			Namespace:   spec.Namespace,
+			Annotations: kubernetes.ManagedAnnotations(),
+			Labels:      labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: spec.StorageSize},
+			},
+		},
+	}
+	if spec.StorageClass != "" {
+		pvc.Spec.StorageClassName = &spec.StorageClass
+	}
+
+	_, err := c.clientset.CoreV1().PersistentVolumeClaims(spec.Namespace).Create(ctx, pvc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("creating PVC %s: %w", pvc.Name, err)
+	}
+	return nil
+}
+
+// Stop stops the KinD nodes of the persistent cluster and deletes its pod to free its resources. Its
+// Service and its PVC are kept, and the pod is recorded on the Service to be recreated by Start.
+func (c *Client) Stop(ctx context.Context, namespace, name string) error {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return clusterError("stop", namespace, name, err)
+	}
+
+	if !isPersistent(pod) {
+		return clusterError("stop", namespace, name, ErrNotPersistent)
+	}
+
+	svcClient := c.clientset.CoreV1().Services(namespace)
+	svc, err := svcClient.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotReady
+		}
+		return clusterError("stop", namespace, name, err)
+	}
+
+	data, err := json.Marshal(recordedPod(pod))
+	if err != nil {
+		return clusterError("stop", namespace, name, err)
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, stopNodesTimeout)
+	defer cancel()
+	clusterName := clusterFromPod(pod, nil).ClusterName
+	if _, err := c.Exec(stopCtx, namespace, name, []string{"bash", "-c", stopNodesScript, "stop", clusterName}); err != nil {
+		return clusterError("stop", namespace, name, fmt.Errorf("stopping the KinD nodes: %w", err))
+	}
+
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[types.StoppedPodAnnotation] = string(data)
+	if _, err := svcClient.Update(ctx, svc, metav1.UpdateOptions{}); err != nil {
+		c.startNodes(namespace, name)
+		return clusterError("stop", namespace, name, fmt.Errorf("recording the pod: %w", err))
+	}
+
+	if err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return clusterError("stop", namespace, name, fmt.Errorf("deleting pod: %w", err))
+	}
+
+	return nil
+}
+
+// startNodes starts the containers stopped by stopNodesScript again when the pod is kept, the context
+// of the stop is not used since it may have been cancelled
+func (c *Client) startNodes(namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	script := `containers=$(docker ps -aq --filter status=exited); [ -z "${containers}" ] || docker start ${containers} > /dev/null`
+	if _, err := c.Exec(ctx, namespace, name, []string{"bash", "-c", script}); err != nil {
+		c.logf("could not start the KinD nodes of %s/%s again: %v\n", namespace, name, err)
+	}
+}
+
+// Start recreates the pod of the stopped cluster on its PVC, the KinD nodes in it are started again
+// instead of creating a new cluster. It returns the cluster with its kubeconfig once it is ready.
+func (c *Client) Start(ctx context.Context, namespace, name string, opts StartOptions) (*Cluster, error) {
+	svcClient := c.clientset.CoreV1().Services(namespace)
+	svc, err := svcClient.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = ErrNotFound
+		}
+		return nil, clusterError("start", namespace, name, err)
+	}
+
+	data, ok := svc.Annotations[types.StoppedPodAnnotation]
+	if !ok {
+		return nil, clusterError("start", namespace, name, ErrNotStopped)
+	}
+
+	podObj := &corev1.Pod{}
+	if err := json.Unmarshal([]byte(data), podObj); err != nil {
+		return nil, clusterError("start", namespace, name, fmt.Errorf("reading the recorded pod: %w", err))
+	}
+
+	_, err = c.clientset.CoreV1().Pods(namespace).Create(ctx, podObj, metav1.CreateOptions{})
+	if err != nil {
+		return nil, clusterError("start", namespace, name, err)
+	}
+
+	spec := Spec{Name: name, Namespace: namespace, Timeout: opts.Timeout, Progress: opts.Progress}
+	if spec.Timeout == 0 {
+		spec.Timeout = 240 * time.Second
+	}
+
+	// the cluster stays stopped if it could not be started, so that it could be started again
+	rollback := func(err error) error {
+		c.logf("rolling back the operation: %v\n", err)
+		return &ClusterError{
+			Op:        "start",
+			Namespace: namespace,
+			Name:      name,
+			Err:       err,
+			Rollback:  c.rollback(namespace, name, []string{"Pod"}),
+		}
+	}
+
+	pod, err := c.waitForPod(ctx, spec)
+	if err != nil {
+		return nil, rollback(fmt.Errorf("waiting for the pod to be ready: %w", err))
+	}
+
+	cluster := clusterFromPod(pod, svc)
+	if err := c.fetchKubeconfig(ctx, cluster); err != nil {
+		return nil, rollback(err)
+	}
+
+	delete(svc.Annotations, types.StoppedPodAnnotation)
+	if _, err := svcClient.Update(ctx, svc, metav1.UpdateOptions{}); err != nil {
+		return nil, clusterError("start", namespace, name, fmt.Errorf("removing the recorded pod: %w", err))
+	}
+
+	return cluster, nil
+}
+
+// isPersistent returns true if the Docker storage of the pod is on a PVC
+func isPersistent(pod *corev1.Pod) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == storageVolume {
+			return v.PersistentVolumeClaim != nil
+		}
+	}
+	return false
+}
+
+// recordedPod returns the pod to be recreated by Start, the fields set by the outer cluster are
+// cleared so that the pod could be scheduled to another node
+func recordedPod(pod *corev1.Pod) *corev1.Pod {
+	recorded := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	recorded.Spec.NodeName = ""
+
+	// the token volume is added again by the outer cluster
+	var volumes []corev1.Volume
+	for _, v := range recorded.Spec.Volumes {
+		if !strings.HasPrefix(v.Name, "kube-api-access-") {
+			volumes = append(volumes, v)
+		}
+	}
+	recorded.Spec.Volumes = volumes
+	for i := range recorded.Spec.Containers {
+		var mounts []corev1.VolumeMount
+		for _, m := range recorded.Spec.Containers[i].VolumeMounts {
+			if !strings.HasPrefix(m.Name, "kube-api-access-") {
+				mounts = append(mounts, m)
+			}
+		}
+		recorded.Spec.Containers[i].VolumeMounts = mounts
+	}
+
+	return recorded
+}
@@ -0,0 +1,240 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kinktest provisions kink clusters for Go tests.
+//
+//	func TestOperator(t *testing.T) {
+//		c := kinktest.NewCluster(t, kinktest.WithKubernetesVersion("1.21"))
+//		nodes, err := c.Client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+//		...
+//	}
+//
+// When KINK_REUSE is set, NewCluster returns the same cluster to every test of the package and it is
+// deleted by Run once all of them complete:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(kinktest.Run(m))
+//	}
+package kinktest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/kink/pkg/kink"
+	kinkkubernetes "github.com/Trendyol/kink/pkg/kubernetes"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ReuseEnv is the environment variable which enables sharing one cluster across the tests
+const ReuseEnv = "KINK_REUSE"
+
+// Cluster is a ready kink cluster
+type Cluster struct {
+	*kink.Cluster
+
+	// Config is the REST config of the cluster
+	Config *rest.Config
+	// Client is the Kubernetes client of the cluster
+	Client kubernetes.Interface
+
+	outer *kink.Client
+}
+
+type options struct {
+	outer *rest.Config
+	spec  kink.Spec
+	// readyTimeout is how long to wait for the API server once the pod is ready
+	readyTimeout time.Duration
+}
+
+// Option customizes the cluster
+type Option func(*options)
+
+// WithRESTConfig sets the outer cluster the kink cluster runs in, the one in the kubeconfig is used by default
+func WithRESTConfig(config *rest.Config) Option {
+	return func(o *options) {
+		o.outer = config
+	}
+}
+
+// WithNamespace sets the namespace of the pod
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.spec.Namespace = namespace
+	}
+}
+
+// WithKubernetesVersion sets the Kubernetes version, it accepts the same values as "kink run -k"
+func WithKubernetesVersion(version string) Option {
+	return func(o *options) {
+		o.spec.KubernetesVersion = version
+	}
+}
+
+// WithTimeout sets how long to wait for the cluster to be ready
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.spec.Timeout = timeout
+		o.readyTimeout = timeout
+	}
+}
+
+// WithSpec customizes the spec of the cluster, it is applied after the other options
+func WithSpec(f func(*kink.Spec)) Option {
+	return func(o *options) {
+		f(&o.spec)
+	}
+}
+
+var (
+	sharedMu      sync.Mutex
+	shared        *Cluster
+	sharedErr     error
+	sharedCleanup func()
+)
+
+// NewCluster provisions a cluster and waits until its API server is ready. The cluster is deleted when
+// the test completes, and its logs are dumped if the test fails. When KINK_REUSE is set, the cluster of
+// the first call is returned to the later ones and their options are ignored.
+func NewCluster(t testing.TB, opts ...Option) *Cluster {
+	t.Helper()
+
+	if os.Getenv(ReuseEnv) == "" {
+		c, cleanup, err := newCluster(t.Logf, opts...)
+		if cleanup != nil {
+			t.Cleanup(func() {
+				if t.Failed() && c != nil {
+					dumpLogs(t, c)
+				}
+				cleanup()
+			})
+		}
+		if err != nil {
+			t.Fatalf("creating kink cluster: %v", err)
+		}
+		return c
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	if shared == nil && sharedErr == nil {
+		// the shared cluster outlives the test, so it could not log through it
+		shared, sharedCleanup, sharedErr = newCluster(log.Printf, opts...)
+	}
+	if sharedErr != nil {
+		t.Fatalf("creating shared kink cluster: %v", sharedErr)
+	}
+
+	c := shared
+	t.Cleanup(func() {
+		if t.Failed() {
+			dumpLogs(t, c)
+		}
+	})
+	return c
+}
+
+// Run runs the tests and deletes the cluster shared by them, its result should be passed to os.Exit
+func Run(m *testing.M) int {
+	code := m.Run()
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if sharedCleanup != nil {
+		sharedCleanup()
+		shared, sharedErr, sharedCleanup = nil, nil, nil
+	}
+
+	return code
+}
+
+// newCluster creates the cluster, the returned cleanup deletes it and is not nil once the pod is created
+func newCluster(logf func(format string, args ...interface{}), opts ...Option) (*Cluster, func(), error) {
+	o := &options{
+		spec: kink.Spec{
+			Name: "kinktest-" + rand.String(8),
+		},
+		readyTimeout: 2 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.outer == nil {
+		config, err := kinkkubernetes.RestClientConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		o.outer = config
+	}
+	if o.spec.Namespace == "" {
+		namespace, _, err := kinkkubernetes.DefaultClientConfig().Namespace()
+		if err != nil {
+			return nil, nil, err
+		}
+		o.spec.Namespace = namespace
+	}
+
+	client, err := kink.NewClient(o.outer)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.Logf = logf
+
+	logf("creating kink cluster %s/%s", o.spec.Namespace, o.spec.Name)
+	cleanup := func() {
+		if err := client.Delete(context.Background(), o.spec.Namespace, o.spec.Name, true); err != nil {
+			logf("deleting kink cluster %s/%s: %v", o.spec.Namespace, o.spec.Name, err)
+		}
+	}
+
+	cluster, err := client.Create(context.Background(), o.spec)
+	if err != nil {
+		// a cluster which does not become ready is already deleted
+		return nil, nil, err
+	}
+
+	c := &Cluster{Cluster: cluster, outer: client}
+	c.Config, err = cluster.RESTConfig()
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	c.Client, err = kubernetes.NewForConfig(c.Config)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	err = wait.PollImmediate(time.Second, o.readyTimeout, func() (bool, error) {
+		_, err := c.Client.Discovery().ServerVersion()
+		return err == nil, nil
+	})
+	if err != nil {
+		return c, cleanup, fmt.Errorf("waiting for the API server of %s/%s: %w", o.spec.Namespace, o.spec.Name, err)
+	}
+
+	return c, cleanup, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// logTailLines is how many lines of the pod logs are dumped
+const logTailLines = 200
+
+// dumpLogs logs the state of the cluster to help debugging the failed test
+func dumpLogs(t testing.TB, c *Cluster) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tailLines := int64(logTailLines)
+	logs, err := c.outer.Clientset().CoreV1().Pods(c.Namespace).GetLogs(c.Name, &corev1.PodLogOptions{
+		Container: "kind-cluster",
+		TailLines: &tailLines,
+	}).DoRaw(ctx)
+	if err != nil {
+		t.Logf("reading logs of pod %s/%s: %v", c.Namespace, c.Name, err)
+	} else {
+		t.Logf("logs of pod %s/%s:\n%s", c.Namespace, c.Name, logs)
+	}
+
+	for _, command := range [][]string{
+		{"kubectl", "get", "nodes", "-o", "wide"},
+		{"kubectl", "get", "pods", "--all-namespaces", "-o", "wide"},
+		{"kubectl", "get", "events", "--all-namespaces", "--sort-by=.lastTimestamp"},
+	} {
+		out, err := c.outer.Exec(ctx, c.Namespace, c.Name, command)
+		if err != nil {
+			t.Logf("running %v in pod %s/%s: %v", command, c.Namespace, c.Name, err)
+			continue
+		}
+		t.Logf("%v:\n%s", command, out)
+	}
+}
@@ -19,6 +19,8 @@ package kubernetes
 import (
 	"fmt"
 
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 
 	// Initialize all known client auth plugins
@@ -35,10 +37,17 @@ func ManagedAnnotations() map[string]string {
 	}
 }
 
+// configFlags holds the kubeconfig flags given on the command line
+var configFlags = genericclioptions.NewConfigFlags(true)
+
+// AddFlags registers the standard kubeconfig flags such as --kubeconfig, --context, --as and --namespace
+func AddFlags(flags *pflag.FlagSet) {
+	configFlags.AddFlags(flags)
+}
+
+// DefaultClientConfig returns the client config of the outer cluster with the kubeconfig flags applied
 func DefaultClientConfig() clientcmd.ClientConfig {
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	return configFlags.ToRawKubeConfigLoader()
 }
 
 func RestClientConfig() (*rest.Config, error) {
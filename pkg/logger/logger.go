@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logger writes the diagnostic messages of kink, the results of the commands are written to
+// stdout separately.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format is the format of the log lines
+type Format string
+
+const (
+	// FormatText writes the messages as they are
+	FormatText Format = "text"
+	// FormatJSON writes a JSON object per message with its time and level
+	FormatJSON Format = "json"
+)
+
+// Level is the severity of a message, the messages above the verbosity of the logger are dropped
+type Level int
+
+const (
+	// LevelError is always logged, even if the logger is quiet
+	LevelError Level = iota - 2
+	// LevelWarn is logged unless the logger is quiet
+	LevelWarn
+	// LevelInfo is logged by default unless the logger is quiet
+	LevelInfo
+	// LevelDebug is logged from verbosity 1
+	LevelDebug
+	// LevelTrace is logged from verbosity 2
+	LevelTrace
+)
+
+var levelNames = map[Level]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+	LevelTrace: "trace",
+}
+
+// Logger writes the messages up to its verbosity
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format Format
+	max    Level
+}
+
+// New returns a logger writing to out. The info messages are written by default, each verbosity level
+// adds a more detailed one and quiet drops everything but the errors.
+func New(out io.Writer, format Format, verbosity int, quiet bool) (*Logger, error) {
+	switch format {
+	case FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid log format %q, it should be one of text or json", format)
+	}
+
+	max := LevelInfo + Level(verbosity)
+	if quiet {
+		max = LevelError
+	}
+
+	return &Logger{out: out, format: format, max: max}, nil
+}
+
+// Enabled returns true if the messages of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level <= l.max
+}
+
+// Errorf writes an error message, it is written even if the logger is quiet
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args...)
+}
+
+// Warnf writes a warning message
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args...)
+}
+
+// Infof writes an informational message
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args...)
+}
+
+// Debugf writes a message which is only written with -v
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// Tracef writes a message which is only written with -vv
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.logf(LevelTrace, format, args...)
+}
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.format == FormatJSON {
+		line, _ := json.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{time.Now().UTC().Format(time.RFC3339), levelNames[level], msg})
+		fmt.Fprintln(l.out, string(line))
+		return
+	}
+
+	switch level {
+	case LevelError:
+		msg = "error: " + msg
+	case LevelWarn:
+		msg = "warning: " + msg
+	}
+	fmt.Fprintln(l.out, msg)
+}
@@ -0,0 +1,355 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// FieldManager is the field manager of the objects applied by kink
+const FieldManager = "kink"
+
+// discoveryTimeout is how long to wait for a kind to be served, such as the kind of a CRD applied
+// just before
+const discoveryTimeout = 30 * time.Second
+
+// Client applies manifests to a cluster
+type Client struct {
+	dynamic dynamic.Interface
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+	// shortcuts resolves the short names of the resources such as deploy or crd
+	shortcuts meta.RESTMapper
+
+	// Logf receives the diagnostic messages, they are discarded if it is nil
+	Logf func(format string, args ...interface{})
+}
+
+// NewClient returns a client for the cluster the REST config points to
+func NewClient(config *rest.Config) (*Client, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating discovery client: %w", err)
+	}
+
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+
+	cached := memory.NewMemCacheClient(dc)
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cached)
+	return &Client{
+		dynamic:   dyn,
+		mapper:    mapper,
+		shortcuts: restmapper.NewShortcutExpander(mapper, cached),
+	}, nil
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// Apply applies the manifests at the paths with server-side apply, see Read for the paths
+func (c *Client) Apply(ctx context.Context, paths []string) error {
+	var objs []*unstructured.Unstructured
+	for _, p := range paths {
+		o, err := Read(ctx, p)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, o...)
+	}
+
+	return c.ApplyObjects(ctx, objs)
+}
+
+// ApplyObjects applies the objects with server-side apply. Namespaces and CRDs are applied first so
+// that the objects depending on them could be applied.
+func (c *Client) ApplyObjects(ctx context.Context, objs []*unstructured.Unstructured) error {
+	sorted := append([]*unstructured.Unstructured(nil), objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyOrder(sorted[i]) < applyOrder(sorted[j])
+	})
+
+	for _, obj := range sorted {
+		if err := c.apply(ctx, obj); err != nil {
+			return fmt.Errorf("applying %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		c.logf("%s/%s applied\n", strings.ToLower(obj.GetKind()), obj.GetName())
+	}
+
+	return nil
+}
+
+// DeleteObjects deletes the objects in the reverse order of ApplyObjects, the objects which do not exist
+// are skipped
+func (c *Client) DeleteObjects(ctx context.Context, objs []*unstructured.Unstructured) error {
+	sorted := append([]*unstructured.Unstructured(nil), objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyOrder(sorted[i]) > applyOrder(sorted[j])
+	})
+
+	propagation := metav1.DeletePropagationBackground
+	for _, obj := range sorted {
+		gvk := obj.GroupVersionKind()
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			// the kind is gone along with its CRD
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("deleting %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+
+		err = c.resource(mapping, namespace).Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("deleting %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		c.logf("%s/%s deleted\n", strings.ToLower(obj.GetKind()), obj.GetName())
+	}
+
+	return nil
+}
+
+func applyOrder(obj *unstructured.Unstructured) int {
+	switch obj.GetKind() {
+	case "Namespace":
+		return 0
+	case "CustomResourceDefinition":
+		return 1
+	}
+	return 2
+}
+
+func (c *Client) apply(ctx context.Context, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	force := true
+	_, err = c.resource(mapping, namespace).Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// restMapping returns the mapping of the kind, the discovery is refreshed until the kind is served
+func (c *Client) restMapping(ctx context.Context, gk schema.GroupKind, version string) (*meta.RESTMapping, error) {
+	pollCtx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	var mapping *meta.RESTMapping
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		var err error
+		mapping, err = c.mapper.RESTMapping(gk, version)
+		if meta.IsNoMatchError(err) {
+			c.mapper.Reset()
+			return false, nil
+		}
+		return err == nil, err
+	}, pollCtx.Done())
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("kind %s is not served by the cluster", gk)
+	}
+	return mapping, err
+}
+
+func (c *Client) resource(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return c.dynamic.Resource(mapping.Resource)
+}
+
+// WaitFor waits until the resources are ready or the context is done. The resources are in the form
+// of [namespace/]resource/name such as deployment/foo, kube-system/ds/kube-proxy or crd/bar.example.com,
+// the namespace defaults to default.
+func (c *Client) WaitFor(ctx context.Context, resources []string) error {
+	for _, r := range resources {
+		namespace, resource, name, err := parseResource(r)
+		if err != nil {
+			return err
+		}
+
+		c.logf("waiting for %s\n", r)
+		err = wait.PollImmediateUntil(2*time.Second, func() (bool, error) {
+			gvk, err := c.shortcuts.KindFor(schema.ParseGroupResource(resource).WithVersion(""))
+			if meta.IsNoMatchError(err) {
+				c.mapper.Reset()
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+
+			mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return false, err
+			}
+
+			obj, err := c.resource(mapping, namespace).Get(ctx, name, metav1.GetOptions{})
+			if k8serrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+
+			return isReady(obj), nil
+		}, ctx.Done())
+
+		if errors.Is(err, wait.ErrWaitTimeout) {
+			return fmt.Errorf("timed out waiting for %s", r)
+		}
+		if err != nil {
+			return fmt.Errorf("waiting for %s: %w", r, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateResources returns an error if any of the resources given to WaitFor is malformed
+func ValidateResources(resources []string) error {
+	for _, r := range resources {
+		if _, _, _, err := parseResource(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseResource(s string) (namespace, resource, name string, err error) {
+	parts := strings.Split(s, "/")
+	switch len(parts) {
+	case 2:
+		namespace, resource, name = metav1.NamespaceDefault, parts[0], parts[1]
+	case 3:
+		namespace, resource, name = parts[0], parts[1], parts[2]
+	}
+	if resource == "" || name == "" || namespace == "" {
+		return "", "", "", fmt.Errorf("invalid resource %q, it should be in the form of [namespace/]resource/name", s)
+	}
+	return namespace, resource, name, nil
+}
+
+// isReady returns true if the object is ready for the kinds known to have a readiness, the other
+// ones are ready if they report so in their conditions or once they exist
+func isReady(obj *unstructured.Unstructured) bool {
+	observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if found && observed < obj.GetGeneration() {
+		return false
+	}
+
+	status := func(fields ...string) int64 {
+		v, _, _ := unstructured.NestedInt64(obj.Object, append([]string{"status"}, fields...)...)
+		return v
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+
+	switch obj.GetKind() {
+	case "CustomResourceDefinition":
+		return conditionTrue(obj, "Established")
+	case "Deployment":
+		return status("updatedReplicas") >= replicas && status("availableReplicas") >= replicas
+	case "StatefulSet":
+		return status("readyReplicas") >= replicas
+	case "DaemonSet":
+		desired := status("desiredNumberScheduled")
+		return status("numberReady") >= desired && status("updatedNumberScheduled") >= desired
+	case "Pod":
+		return conditionTrue(obj, "Ready")
+	case "Job":
+		return conditionTrue(obj, "Complete")
+	case "PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return phase == "Bound"
+	}
+
+	for _, t := range []string{"Ready", "Available"} {
+		if _, ok := condition(obj, t); ok {
+			return conditionTrue(obj, t)
+		}
+	}
+	return true
+}
+
+func condition(obj *unstructured.Unstructured, conditionType string) (string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != conditionType {
+			continue
+		}
+		status, _ := m["status"].(string)
+		return status, true
+	}
+	return "", false
+}
+
+func conditionTrue(obj *unstructured.Unstructured, conditionType string) bool {
+	status, _ := condition(obj, conditionType)
+	return status == string(metav1.ConditionTrue)
+}
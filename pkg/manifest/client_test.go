@@ -0,0 +1,150 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseResource(t *testing.T) {
+	tests := []struct {
+		in                        string
+		namespace, resource, name string
+		wantErr                   bool
+	}{
+		{in: "deployment/operator", namespace: "default", resource: "deployment", name: "operator"},
+		{in: "operators/deployment/operator", namespace: "operators", resource: "deployment", name: "operator"},
+		{in: "crd/bars.example.com", namespace: "default", resource: "crd", name: "bars.example.com"},
+		{in: "operator", wantErr: true},
+		{in: "deployment/", wantErr: true},
+		{in: "/deployment/operator", wantErr: true},
+		{in: "a/b/c/d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		namespace, resource, name, err := parseResource(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResource(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if namespace != tt.namespace || resource != tt.resource || name != tt.name {
+			t.Errorf("parseResource(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.in, namespace, resource, name, tt.namespace, tt.resource, tt.name)
+		}
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		object map[string]interface{}
+		want   bool
+	}{
+		{
+			name: "available deployment",
+			object: object("Deployment", 2, map[string]interface{}{
+				"observedGeneration": int64(2), "updatedReplicas": int64(3), "availableReplicas": int64(3),
+			}, "replicas", int64(3)),
+			want: true,
+		},
+		{
+			name: "rolling deployment",
+			object: object("Deployment", 2, map[string]interface{}{
+				"observedGeneration": int64(2), "updatedReplicas": int64(1), "availableReplicas": int64(3),
+			}, "replicas", int64(3)),
+		},
+		{
+			name: "deployment not observed yet",
+			object: object("Deployment", 3, map[string]interface{}{
+				"observedGeneration": int64(2), "updatedReplicas": int64(1), "availableReplicas": int64(1),
+			}),
+		},
+		{
+			name:   "statefulset",
+			object: object("StatefulSet", 1, map[string]interface{}{"readyReplicas": int64(2)}, "replicas", int64(2)),
+			want:   true,
+		},
+		{
+			name: "daemonset",
+			object: object("DaemonSet", 1, map[string]interface{}{
+				"desiredNumberScheduled": int64(3), "numberReady": int64(2), "updatedNumberScheduled": int64(3),
+			}),
+		},
+		{
+			name:   "established crd",
+			object: object("CustomResourceDefinition", 1, conditions("Established", "True")),
+			want:   true,
+		},
+		{
+			name:   "incomplete job",
+			object: object("Job", 1, conditions("Complete", "False")),
+		},
+		{
+			name:   "bound pvc",
+			object: object("PersistentVolumeClaim", 1, map[string]interface{}{"phase": "Bound"}),
+			want:   true,
+		},
+		{
+			name:   "other kind not ready",
+			object: object("Certificate", 1, conditions("Ready", "False")),
+		},
+		{
+			name:   "other kind available",
+			object: object("APIService", 1, conditions("Available", "True")),
+			want:   true,
+		},
+		{
+			name:   "other kind without conditions",
+			object: object("ConfigMap", 1, nil),
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := isReady(&unstructured.Unstructured{Object: tt.object}); got != tt.want {
+			t.Errorf("%s: isReady() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// object returns an object of the kind with the status, the spec is given as key value pairs
+func object(kind string, generation int64, status map[string]interface{}, spec ...interface{}) map[string]interface{} {
+	specMap := map[string]interface{}{}
+	for i := 0; i+1 < len(spec); i += 2 {
+		specMap[spec[i].(string)] = spec[i+1]
+	}
+
+	obj := map[string]interface{}{
+		"kind":     kind,
+		"metadata": map[string]interface{}{"name": "test", "generation": generation},
+		"spec":     specMap,
+	}
+	if status != nil {
+		obj["status"] = status
+	}
+	return obj
+}
+
+func conditions(conditionType, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": conditionType, "status": status},
+		},
+	}
+}
@@ -20,5 +20,36 @@ const (
 	NodeImageRepository = "trendyoltech/kind-node"
 	ImageRepository     = "trendyoltech/kind-cluster"
 	NodeImageTag        = "1.21.2"
-	ImageTag            = "v0.0.1"
+	ImageTag            = "v0.5.0"
+	RegistryPort        = 5001
+)
+
+// Labels kink puts on the pods and services it creates
+const (
+	OwnerLabel = "runned-by"
+	UUIDLabel  = "generated-uuid"
+	// CI labels identify the CI job which created the cluster
+	CIPipelineLabel = "kink.trendyol.com/ci-pipeline"
+	CIJobLabel      = "kink.trendyol.com/ci-job"
+	CICommitLabel   = "kink.trendyol.com/ci-commit"
+	// PoolLabel holds the pool a cluster is created for, PoolClaimedLabel is "true" once it is claimed
+	PoolLabel        = "kink.trendyol.com/pool"
+	PoolClaimedLabel = "kink.trendyol.com/claimed"
+)
+
+// Annotations kink records on the pods it creates
+const (
+	RegistryAnnotation  = "kink.trendyol.com/registry"
+	ImageAnnotation     = "kink.trendyol.com/image"
+	NodeImageAnnotation = "kink.trendyol.com/node-image"
+	TTLAnnotation       = "kink.trendyol.com/ttl"
+	ExpiresAtAnnotation = "kink.trendyol.com/expires-at"
+	// KubernetesVersionAnnotation holds the version the requested one is resolved to
+	KubernetesVersionAnnotation          = "kink.trendyol.com/kubernetes-version"
+	RequestedKubernetesVersionAnnotation = "kink.trendyol.com/requested-kubernetes-version"
+	// SnapshotAnnotation holds the snapshot a cluster is restored from, and the info of the snapshot
+	// on the PVC holding it
+	SnapshotAnnotation = "kink.trendyol.com/snapshot"
+	// StoppedPodAnnotation holds the pod of a stopped cluster on its Service, "kink start" recreates it
+	StoppedPodAnnotation = "kink.trendyol.com/stopped-pod"
 )
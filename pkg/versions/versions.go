@@ -0,0 +1,260 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// cache is the last known tag list of a node image repository
+type cache struct {
+	Repository string    `json:"repository"`
+	Tags       []string  `json:"tags"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Tags returns the tags of the node image repository. The tags are cached on disk, and the cache is
+// used when the registry could not be reached; fromCache reports whether that happened.
+func Tags(ctx context.Context, repository string) (tags []string, fromCache bool, err error) {
+	tags, err = crane.ListTags(repository, crane.WithContext(ctx))
+	if err == nil {
+		_ = writeCache(repository, tags)
+		return tags, false, nil
+	}
+	if ctx.Err() != nil {
+		return nil, false, ctx.Err()
+	}
+
+	c, cacheErr := readCache(repository)
+	if cacheErr != nil {
+		return nil, false, fmt.Errorf("reading tags for %s: %w", repository, err)
+	}
+
+	return c.Tags, true, nil
+}
+
+// Sort returns the semantic versions among the tags in ascending order, other tags are ignored
+func Sort(tags []string) []*version.Version {
+	var vs []*version.Version
+	for _, t := range tags {
+		if !strings.HasPrefix(t, "v") {
+			continue
+		}
+
+		v, err := version.ParseSemantic(t)
+		if err != nil {
+			continue
+		}
+		vs = append(vs, v)
+	}
+
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i].LessThan(vs[j])
+	})
+
+	return vs
+}
+
+// Filter returns the versions between min and max inclusive, an empty bound is ignored. The bounds
+// could be partial versions such as 1.20 which matches every patch release of it.
+func Filter(vs []*version.Version, min, max string) ([]*version.Version, error) {
+	var minV, maxV *version.Version
+	var err error
+	if min != "" {
+		if minV, err = version.ParseGeneric(min); err != nil {
+			return nil, fmt.Errorf("invalid minimum version %q: %w", min, err)
+		}
+	}
+	if max != "" {
+		if maxV, err = version.ParseGeneric(max); err != nil {
+			return nil, fmt.Errorf("invalid maximum version %q: %w", max, err)
+		}
+	}
+
+	var filtered []*version.Version
+	for _, v := range vs {
+		if minV != nil && v.LessThan(minV) {
+			continue
+		}
+		if maxV != nil && !v.LessThan(maxV) && !matchesPartial(v, max, maxV) {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+
+	return filtered, nil
+}
+
+// matchesPartial returns true if v is the same as bound on the components the bound specifies
+func matchesPartial(v *version.Version, bound string, boundV *version.Version) bool {
+	components := len(strings.Split(strings.TrimPrefix(bound, "v"), "."))
+	if v.Major() != boundV.Major() || v.Minor() != boundV.Minor() {
+		return false
+	}
+	return components < 3 || v.Patch() == boundV.Patch()
+}
+
+// Resolve resolves the requested version against the tags to a concrete vX.Y.Z version. Besides full
+// versions it accepts "latest", partial versions such as 1.21 which resolve to their newest patch release,
+// and "stable-N" which resolves to the newest patch release of the minor version N releases before the
+// newest one. Pre-releases such as v1.22.0-rc.0 are only resolved if they are requested exactly.
+func Resolve(tags []string, requested string) (string, error) {
+	if IsConcrete(requested) {
+		if !Contains(tags, requested) {
+			return "", fmt.Errorf("version %s is not found", requested)
+		}
+		return "v" + strings.TrimPrefix(requested, "v"), nil
+	}
+
+	vs := Releases(Sort(tags))
+	if len(vs) == 0 {
+		return "", errors.New("there is not any version to resolve against")
+	}
+
+	switch {
+	case requested == "latest" || requested == "stable":
+		return "v" + vs[len(vs)-1].String(), nil
+	case strings.HasPrefix(requested, "stable-"):
+		n, err := strconv.Atoi(strings.TrimPrefix(requested, "stable-"))
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid version alias %q, it should be in the form of stable-N", requested)
+		}
+
+		minors := newestPatches(vs)
+		if n >= len(minors) {
+			return "", fmt.Errorf("there are only %d minor versions, %s could not be resolved", len(minors), requested)
+		}
+		return "v" + minors[n].String(), nil
+	}
+
+	if parts := strings.Split(strings.TrimPrefix(requested, "v"), "."); len(parts) == 2 {
+		partial, err := version.ParseGeneric(requested)
+		if err != nil {
+			return "", fmt.Errorf("invalid version %q: %w", requested, err)
+		}
+
+		for i := len(vs) - 1; i >= 0; i-- {
+			if vs[i].Major() == partial.Major() && vs[i].Minor() == partial.Minor() {
+				return "v" + vs[i].String(), nil
+			}
+		}
+		return "", fmt.Errorf("there is not any patch release of %s", requested)
+	}
+
+	return "", fmt.Errorf("invalid version %q, it should be a version such as 1.21.2 or 1.21, latest or stable-N", requested)
+}
+
+// IsConcrete returns true if the version is a full X.Y.Z version rather than an alias or a partial version
+func IsConcrete(v string) bool {
+	_, err := version.ParseSemantic("v" + strings.TrimPrefix(v, "v"))
+	return err == nil
+}
+
+// Releases returns the versions without the pre-releases, the same ones "latest" is resolved among
+func Releases(vs []*version.Version) []*version.Version {
+	var released []*version.Version
+	for _, v := range vs {
+		if v.PreRelease() == "" {
+			released = append(released, v)
+		}
+	}
+	return released
+}
+
+// newestPatches returns the newest patch release of each minor version, the newest minor comes first
+func newestPatches(vs []*version.Version) []*version.Version {
+	var newest []*version.Version
+	for i := len(vs) - 1; i >= 0; i-- {
+		last := len(newest) - 1
+		if last >= 0 && newest[last].Major() == vs[i].Major() && newest[last].Minor() == vs[i].Minor() {
+			continue
+		}
+		newest = append(newest, vs[i])
+	}
+	return newest
+}
+
+// Contains returns true if the version is one of the tags, with or without the "v" prefix
+func Contains(tags []string, v string) bool {
+	v = "v" + strings.TrimPrefix(v, "v")
+	for _, t := range tags {
+		if t == v {
+			return true
+		}
+	}
+	return false
+}
+
+func cachePath(repository string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	file := strings.NewReplacer("/", "_", ":", "_").Replace(repository) + ".json"
+	return filepath.Join(dir, "kink", "tags", file), nil
+}
+
+func readCache(repository string) (*cache, error) {
+	path, err := cachePath(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cache{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func writeCache(repository string, tags []string) error {
+	path, err := cachePath(repository)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cache{Repository: repository, Tags: tags, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 pe.container <pe.container@trendyol.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versions
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+var tags = []string{"v1.19.11", "v1.20.7", "v1.21.1", "v1.21.2", "v1.22.0-rc.0", "latest", "foo"}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{requested: "latest", want: "v1.21.2"},
+		{requested: "stable", want: "v1.21.2"},
+		{requested: "stable-0", want: "v1.21.2"},
+		{requested: "stable-1", want: "v1.20.7"},
+		{requested: "stable-2", want: "v1.19.11"},
+		{requested: "stable-3", wantErr: true},
+		{requested: "stable-x", wantErr: true},
+		{requested: "stable--1", wantErr: true},
+		{requested: "1.21", want: "v1.21.2"},
+		{requested: "v1.20", want: "v1.20.7"},
+		{requested: "1.22", wantErr: true},
+		{requested: "1.21.1", want: "v1.21.1"},
+		{requested: "v1.21.1", want: "v1.21.1"},
+		{requested: "v1.22.0-rc.0", want: "v1.22.0-rc.0"},
+		{requested: "1.18.0", wantErr: true},
+		{requested: "1", wantErr: true},
+		{requested: "foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Resolve(tags, tt.requested)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Resolve(%q) error = %v, wantErr %v", tt.requested, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestResolveWithoutReleases(t *testing.T) {
+	if _, err := Resolve([]string{"v1.22.0-rc.0", "latest"}, "latest"); err == nil {
+		t.Error("Resolve(latest) without any release should fail")
+	}
+}
+
+func TestSortAndReleases(t *testing.T) {
+	if got, want := versionStrings(Sort(tags)), []string{"1.19.11", "1.20.7", "1.21.1", "1.21.2", "1.22.0-rc.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort() = %v, want %v", got, want)
+	}
+	if got, want := versionStrings(Releases(Sort(tags))), []string{"1.19.11", "1.20.7", "1.21.1", "1.21.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Releases() = %v, want %v", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		min, max string
+		want     []string
+		wantErr  bool
+	}{
+		{want: []string{"1.19.11", "1.20.7", "1.21.1", "1.21.2", "1.22.0-rc.0"}},
+		{min: "1.20", want: []string{"1.20.7", "1.21.1", "1.21.2", "1.22.0-rc.0"}},
+		{max: "1.21", want: []string{"1.19.11", "1.20.7", "1.21.1", "1.21.2"}},
+		{max: "1.21.1", want: []string{"1.19.11", "1.20.7", "1.21.1"}},
+		{min: "1.20", max: "1.20", want: []string{"1.20.7"}},
+		{min: "1.23", want: nil},
+		{min: "foo", wantErr: true},
+		{max: "foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Filter(Sort(tags), tt.min, tt.max)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Filter(%q, %q) error = %v, wantErr %v", tt.min, tt.max, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(versionStrings(got), tt.want) {
+			t.Errorf("Filter(%q, %q) = %v, want %v", tt.min, tt.max, versionStrings(got), tt.want)
+		}
+	}
+}
+
+func TestIsConcrete(t *testing.T) {
+	tests := map[string]bool{
+		"1.21.2":       true,
+		"v1.21.2":      true,
+		"v1.22.0-rc.0": true,
+		"1.21":         false,
+		"latest":       false,
+		"stable-1":     false,
+	}
+
+	for v, want := range tests {
+		if got := IsConcrete(v); got != want {
+			t.Errorf("IsConcrete(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	if !Contains(tags, "1.21.2") || !Contains(tags, "v1.21.2") {
+		t.Error("Contains() should match the versions with and without the v prefix")
+	}
+	if Contains(tags, "1.21") {
+		t.Error("Contains() should not match partial versions")
+	}
+}
+
+func versionStrings(vs []*version.Version) []string {
+	var s []string
+	for _, v := range vs {
+		s = append(s, v.String())
+	}
+	return s
+}
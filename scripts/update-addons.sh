@@ -0,0 +1,43 @@
+#!/bin/sh
+# Vendors the pinned upstream manifests of the add-ons into pkg/addon/manifests, bump the versions here
+# and in pkg/addon/addon.go together.
+set -e
+cd pkg/addon/manifests
+
+# fetch name version url [filter]
+fetch() {
+	curl -fsSL "$3" >"$1/$1.yaml.tmp"
+	{
+		echo "# $1 $2, $3"
+		echo "# Run scripts/update-addons.sh to refresh it from upstream."
+		${4:-cat} <"$1/$1.yaml.tmp"
+	} >"$1/$1.yaml"
+	rm "$1/$1.yaml.tmp"
+}
+
+# open_schemas replaces the validation schemas of the CRDs with open ones, they make up most of the
+# cert-manager manifest embedded into kink and its webhook validates the resources anyway
+open_schemas() {
+	awk '
+		skip {
+			match($0, /^ */)
+			if (NF == 0 || RLENGTH > indent) next
+			skip = 0
+		}
+		/^ *openAPIV3Schema:$/ {
+			print
+			match($0, /^ */)
+			indent = RLENGTH
+			pad = sprintf("%" (indent + 2) "s", "")
+			print pad "type: object"
+			print pad "x-kubernetes-preserve-unknown-fields: true"
+			skip = 1
+			next
+		}
+		{ print }
+	'
+}
+
+fetch cert-manager v1.5.4 https://github.com/jetstack/cert-manager/releases/download/v1.5.4/cert-manager.yaml open_schemas
+fetch ingress-nginx controller-v1.0.4 https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-v1.0.4/deploy/static/provider/kind/deploy.yaml
+fetch metrics-server v0.5.1 https://github.com/kubernetes-sigs/metrics-server/releases/download/v0.5.1/components.yaml